@@ -4,23 +4,84 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/apikey"
+	"github.com/qcasey/airphoto-server/routes/activity"
 	"github.com/qcasey/airphoto-server/routes/album"
+	"github.com/qcasey/airphoto-server/routes/asset"
+	"github.com/qcasey/airphoto-server/routes/delta"
+	"github.com/qcasey/airphoto-server/routes/feed"
+	"github.com/qcasey/airphoto-server/routes/geo"
+	"github.com/qcasey/airphoto-server/routes/gql"
+	"github.com/qcasey/airphoto-server/routes/identity"
+	"github.com/qcasey/airphoto-server/routes/keys"
 	"github.com/qcasey/airphoto-server/routes/notification"
+	"github.com/qcasey/airphoto-server/routes/openapi"
+	"github.com/qcasey/airphoto-server/routes/removed"
+	"github.com/qcasey/airphoto-server/routes/share"
+	"github.com/qcasey/airphoto-server/routes/stats"
+	"github.com/qcasey/airphoto-server/routes/ui"
 	"github.com/qcasey/airphoto-server/server"
 )
 
 func bindRoutes(srv *server.Server, r *mux.Router) {
-	r.HandleFunc("/albums/{guid}", album.Get(srv)).Methods(http.MethodGet)
-	r.HandleFunc("/albums", album.GetList(srv)).Methods(http.MethodGet)
-	r.HandleFunc("/albums/all", album.GetAll(srv)).Methods(http.MethodGet)
+	r.Use(server.Compress)
 
-	// Optionally handle firebase device tokens
-	if srv.Viper.GetBool("useFirebase") {
-		r.HandleFunc("/device/{token}", notification.Post(srv)).Methods("POST")
-	}
+	// Share links carry their own signed token instead of the API token
+	r.HandleFunc("/s/{token}", share.View(srv)).Methods(http.MethodGet)
+	r.HandleFunc("/s/{token}/json", share.GetJSON(srv)).Methods(http.MethodGet)
+	r.HandleFunc("/s/{token}/assets/{asset}/file", share.GetFile(srv)).Methods(http.MethodGet)
+
+	// Web gallery, it asks for the API token itself
+	r.PathPrefix("/ui/").Handler(http.StripPrefix("/ui/", ui.Handler())).Methods(http.MethodGet)
+	r.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently)).Methods(http.MethodGet)
+
+	// API description for generating clients, it holds nothing private
+	r.HandleFunc("/openapi.json", openapi.Get()).Methods(http.MethodGet)
 
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		r.Write(w)
 	}).Methods(http.MethodGet)
+
+	// Everything else requires an API key with the route's scope
+	api := r.NewRoute().Subrouter()
+	api.Use(srv.Authenticate)
+
+	read, media, admin := apikey.ScopeAlbums, apikey.ScopeMedia, apikey.ScopeAdmin
+	api.HandleFunc("/albums/all", srv.Require(read, album.GetAll(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums/{guid}", srv.Require(read, album.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums/{guid}/moments", srv.Require(read, album.GetMoments(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums/{guid}/stats", srv.Require(read, album.GetStats(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums/{guid}/geo", srv.Require(read, geo.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums/{guid}/feed.atom", srv.Require(read, feed.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums/{guid}/export.zip", srv.Require(media, album.GetExport(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums/{guid}/assets/{asset}/file", srv.Require(media, asset.GetFile(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/albums", srv.Require(read, album.GetList(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/activity", srv.Require(read, activity.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/me", srv.Require(read, identity.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/stats", srv.Require(read, stats.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/geo", srv.Require(read, geo.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/feed.atom", srv.Require(read, feed.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/removed", srv.Require(read, removed.GetList(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/sync", srv.Require(read, delta.Get(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/graphql", srv.Require(read, gql.Handler(srv))).Methods(http.MethodGet, http.MethodPost)
+
+	// Versioned routes respond with the stable types in pkg/api/v1
+	v1 := api.PathPrefix("/v1").Subrouter()
+	v1.HandleFunc("/albums", srv.Require(read, album.GetListV1(srv))).Methods(http.MethodGet)
+	v1.HandleFunc("/albums/all", srv.Require(read, album.GetAllV1(srv))).Methods(http.MethodGet)
+	v1.HandleFunc("/albums/{guid}", srv.Require(read, album.GetV1(srv))).Methods(http.MethodGet)
+
+	// Share link and key administration
+	api.HandleFunc("/shares", srv.Require(admin, share.GetList(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/shares", srv.Require(admin, share.Post(srv))).Methods(http.MethodPost)
+	api.HandleFunc("/shares/{id}", srv.Require(admin, share.Delete(srv))).Methods(http.MethodDelete)
+	api.HandleFunc("/keys", srv.Require(admin, keys.GetList(srv))).Methods(http.MethodGet)
+	api.HandleFunc("/keys", srv.Require(admin, keys.Post(srv))).Methods(http.MethodPost)
+	api.HandleFunc("/keys/{name}", srv.Require(admin, keys.Delete(srv))).Methods(http.MethodDelete)
+
+	// Optionally handle firebase device tokens
+	if srv.Viper.GetBool("useFirebase") {
+		api.HandleFunc("/device/{token}", srv.Require(apikey.ScopeDevices, notification.Post(srv))).Methods("POST")
+	}
 }
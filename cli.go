@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/comment"
+	"github.com/qcasey/airphoto-server/server"
+	"github.com/spf13/pflag"
+)
+
+var jsonOutput = pflag.Bool("json", false, "Print subcommand output as JSON instead of a table")
+
+// command inspects the database without starting the server
+type command struct {
+	usage string
+	args  int
+	run   func(srv *server.Server, args []string) error
+}
+
+var commands = map[string]command{
+	"albums":     {"albums", 0, listAlbums},
+	"assets":     {"assets <album GUID>", 1, listAssets},
+	"comments":   {"comments <asset GUID>", 1, listComments},
+	"dump-plist": {"dump-plist <asset or comment GUID>", 1, dumpPlist},
+}
+
+// runCommand runs the subcommand named by args[0]
+func runCommand(srv *server.Server, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok || len(args)-1 != cmd.args {
+		return errors.New(usage())
+	}
+
+	// Keep stdout clean for the command's output
+	asset.ShowProgress = false
+	if err := srv.OpenDatabase(); err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+	return cmd.run(srv, args[1:])
+}
+
+func usage() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("usage: airphoto [--json] <command>, with no command the server is started. Commands:")
+	for _, name := range names {
+		b.WriteString("\n  airphoto " + commands[name].usage)
+	}
+	return b.String()
+}
+
+func listAlbums(srv *server.Server, args []string) error {
+	albums, err := album.GetAlbumList()
+	if err != nil {
+		return err
+	}
+	sort.Slice(albums, func(i, j int) bool {
+		return albums[i].Name < albums[j].Name
+	})
+	if *jsonOutput {
+		return printJSON(albums)
+	}
+
+	w := newTable("GUID", "NAME", "ASSETS", "URL")
+	for _, a := range albums {
+		count, err := asset.Count(a.GUID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", a.GUID, a.Name, count, a.URL)
+	}
+	return w.Flush()
+}
+
+func listAssets(srv *server.Server, args []string) error {
+	assets, _, err := asset.GetAssets(args[0], false, nil, srv.Location)
+	if err != nil {
+		return err
+	}
+	if len(assets) == 0 {
+		return fmt.Errorf("no assets found in album %s", args[0])
+	}
+
+	list := make(asset.List, 0, len(assets))
+	for _, a := range assets {
+		list = append(list, a.In(srv.Location))
+	}
+	sort.Sort(list)
+	if *jsonOutput {
+		return printJSON(list)
+	}
+
+	w := newTable("GUID", "DATE", "AUTHOR", "FILENAME", "SIZE", "COMMENTS")
+	for _, a := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%dx%d\t%d\n", a.GUID, formatDate(a.Date), a.Author, a.Filename, a.Width, a.Height, len(a.Comments))
+	}
+	return w.Flush()
+}
+
+func listComments(srv *server.Server, args []string) error {
+	comments, err := comment.GetComments(args[0], nil)
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return fmt.Errorf("no comments found on asset %s", args[0])
+	}
+
+	list := make([]comment.Comment, 0, len(comments))
+	for _, c := range comments {
+		list = append(list, c.In(srv.Location))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.Before(list[j].Date)
+	})
+	if *jsonOutput {
+		return printJSON(list)
+	}
+
+	w := newTable("GUID", "DATE", "AUTHOR", "KIND", "CONTENT")
+	for _, c := range list {
+		kind := "comment"
+		if c.IsCaption {
+			kind = "caption"
+		} else if c.IsLike {
+			kind = "like"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.GUID, formatDate(c.Date), c.AuthorName, kind, c.Content)
+	}
+	return w.Flush()
+}
+
+// dumpPlist prints the raw plist behind an asset or comment, which is always JSON
+func dumpPlist(srv *server.Server, args []string) error {
+	plist, err := asset.GetPlist(args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		plist, err = comment.GetPlist(args[0])
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no asset or comment %s", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(plist)
+}
+
+func newTable(columns ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	return w
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -1,11 +1,25 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Connection pool limits. Refreshes parse assets concurrently, handlers never query directly.
+const (
+	maxOpenConns    = 8
+	maxIdleConns    = 2
+	connMaxLifetime = 5 * time.Minute
+	busyTimeout     = 5000 // milliseconds
 )
 
 var (
@@ -13,25 +27,89 @@ var (
 	DB   *sql.DB
 	File string
 
+	// Immutable tells SQLite File never changes, skipping locking entirely, set from the dbImmutable option.
+	// SQLite then ignores any -wal file, and a write during a refresh can leave it reading stale or torn data.
+	// SnapshotCopy copies through the same connections, so its copies miss whatever is only in the -wal as well.
+	Immutable bool
+
 	LastModified time.Time
 	lock         sync.RWMutex
+
+	// tx is the read transaction of the running Snapshot, guarded by lock
+	tx            *sql.Tx
+	snapshotMutex sync.Mutex
 )
 
+// dsn opens path read-only through a URI, iCloud's daemons are the only writers
+func dsn(path string, immutable bool) string {
+	path = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
+	params := fmt.Sprintf("mode=ro&_busy_timeout=%d", busyTimeout)
+	if immutable {
+		params += "&immutable=1"
+	}
+	return "file:" + path + "?" + params
+}
+
+func open(path string, immutable bool) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dsn(path, immutable))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxLifetime(connMaxLifetime)
+
+	// sql.Open is lazy, make sure the file can actually be read
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
 func Open() error {
-	var err error
-	DB, err = sql.Open("sqlite3", File)
+	db, err := open(File, Immutable)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	old := DB
+	DB = db
+	lock.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close closes the connection pool
+func Close() error {
+	lock.Lock()
+	defer lock.Unlock()
+	if DB == nil {
+		return nil
+	}
+	err := DB.Close()
+	DB = nil
 	return err
 }
 
-func Query(SQL string) (*sql.Rows, error) {
-	// Open new connection to the DB if it's been closed.
-	// Some connections are persistent, to speed up rapid fire queries
-	if err := DB.Ping(); err != nil {
-		Open()
-		defer DB.Close()
+// Query runs SQL against the database, inside the running Snapshot's transaction if there is one
+func Query(SQL string, args ...interface{}) (*sql.Rows, error) {
+	lock.RLock()
+	var rows *sql.Rows
+	var err error
+	switch {
+	case tx != nil:
+		rows, err = tx.Query(SQL, args...)
+	case DB != nil:
+		rows, err = DB.Query(SQL, args...)
+	default:
+		err = fmt.Errorf("database is not open")
 	}
+	lock.RUnlock()
 
-	rows, err := DB.Query(SQL)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +119,134 @@ func Query(SQL string) (*sql.Rows, error) {
 	return rows, nil
 }
 
+// Snapshot runs fn inside a single read transaction, so every Query it makes sees the database
+// as it was at the first one, even while iCloud writes to it. Snapshots don't overlap.
+func Snapshot(fn func() error) error {
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	db, done, err := current()
+	if err != nil {
+		return err
+	}
+	defer done()
+	return snapshot(db, fn)
+}
+
+// current returns the pool to read a snapshot through, and a function to call once done with it.
+// Immutable connections never notice the file changed, so each snapshot then gets fresh ones.
+func current() (*sql.DB, func(), error) {
+	lock.RLock()
+	db := DB
+	lock.RUnlock()
+	if db == nil {
+		return nil, nil, fmt.Errorf("database is not open")
+	}
+	if !Immutable {
+		return db, func() {}, nil
+	}
+
+	fresh, err := open(File, Immutable)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fresh, func() { fresh.Close() }, nil
+}
+
+// SnapshotCopy copies the database into a temporary directory under dir, or the system's when empty,
+// and runs fn like Snapshot against the copy, so parsing can't collide with iCloud's writes.
+// Nothing else writes to the copy, so it's opened immutable. The copy is deleted afterwards.
+func SnapshotCopy(dir string, fn func() error) error {
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	src, done, err := current()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tmp, err := ioutil.TempDir(dir, "airphoto-snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, filepath.Base(File))
+	if err := backup(src, path); err != nil {
+		return fmt.Errorf("could not copy database: %w", err)
+	}
+
+	db, err := open(path, true)
+	if err != nil {
+		return fmt.Errorf("could not open database copy: %w", err)
+	}
+	defer db.Close()
+	return snapshot(db, fn)
+}
+
+// backup copies src to path with SQLite's online backup, which reads every page within one read transaction.
+// Copying the files instead could pair a -wal with a main file from another point in time.
+func backup(src *sql.DB, path string) error {
+	ctx := context.Background()
+	dst, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			b, err := dstDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			// A negative step copies every page at once
+			if _, err := b.Step(-1); err != nil {
+				b.Close()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// snapshot runs fn with Query reading from a read transaction on db. The caller must hold snapshotMutex.
+func snapshot(db *sql.DB, fn func() error) error {
+	t, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	tx = t
+	lock.Unlock()
+
+	defer func() {
+		lock.Lock()
+		tx = nil
+		lock.Unlock()
+	}()
+
+	fnErr := fn()
+	// Nothing was written, rolling back just releases the snapshot
+	if err := t.Rollback(); err != nil && fnErr == nil {
+		return err
+	}
+	return fnErr
+}
+
 func HasBeenModified() bool {
 	// Get SQL file info
 	info, err := os.Stat(File)
@@ -0,0 +1,243 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Columns maps what the queries read onto the tables and columns of one schema version
+type Columns struct {
+	Albums    string
+	AlbumGUID string
+	AlbumName string
+	AlbumURL  string
+
+	Assets         string
+	AssetGUID      string
+	AssetAlbumGUID string
+	AssetBatchDate string
+	AssetNumber    string
+	AssetPlist     string
+
+	Comments         string
+	CommentGUID      string
+	CommentAssetGUID string
+	CommentTimestamp string
+	CommentIsCaption string
+	CommentIsMine    string
+	CommentPlist     string
+}
+
+// Layout holds the queries for one version of the MediaStream schema, built from its Columns.
+// Queries take the album or asset GUID as their "?" parameter.
+type Layout struct {
+	Name string
+	// Versions are the PRAGMA user_version values the layout applies to
+	Versions []int
+	Columns  Columns
+
+	// Albums selects GUID, name and URL
+	Albums string
+	// AssetCount counts an album's assets
+	AssetCount string
+	// Assets selects album GUID, GUID, batch date, photo number and plist of an album's assets, newest batch first
+	Assets string
+	// AssetPlist selects the plist of one asset
+	AssetPlist string
+	// Comments selects asset GUID, GUID, timestamp, isCaption, isMine and plist of an asset's comments, newest first.
+	// "%s" is where extra conditions on CommentGUID are added.
+	Comments    string
+	CommentGUID string
+	// CommentPlist selects the plist of one comment
+	CommentPlist string
+}
+
+// newLayout builds the queries of a schema version from its column mapping
+func newLayout(name string, versions []int, c Columns) Layout {
+	commentGUID := c.Comments + "." + c.CommentGUID
+	return Layout{
+		Name:     name,
+		Versions: versions,
+		Columns:  c,
+
+		Albums:     fmt.Sprintf("SELECT %s, %s, %s FROM %s", c.AlbumGUID, c.AlbumName, c.AlbumURL, c.Albums),
+		AssetCount: fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", c.Assets, c.AssetAlbumGUID),
+		Assets: fmt.Sprintf("SELECT %s, %s, %s, %s, %s FROM %s WHERE %s = ? ORDER BY %s DESC",
+			c.AssetAlbumGUID, c.AssetGUID, c.AssetBatchDate, c.AssetNumber, c.AssetPlist, c.Assets, c.AssetAlbumGUID, c.AssetBatchDate),
+		AssetPlist: fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", c.AssetPlist, c.Assets, c.AssetGUID),
+		Comments: fmt.Sprintf("SELECT %[1]s.%[3]s, %[2]s.%[4]s, %[2]s.%[6]s, %[2]s.%[7]s, %[2]s.%[8]s, %[2]s.%[9]s "+
+			"FROM %[2]s LEFT OUTER JOIN %[1]s on %[1]s.%[3]s = %[2]s.%[5]s WHERE %[1]s.%[3]s = ?%%s ORDER BY %[2]s.%[6]s DESC",
+			c.Assets, c.Comments, c.AssetGUID, c.CommentGUID, c.CommentAssetGUID, c.CommentTimestamp, c.CommentIsCaption, c.CommentIsMine, c.CommentPlist),
+		CommentGUID:  commentGUID,
+		CommentPlist: fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", c.CommentPlist, c.Comments, c.CommentGUID),
+	}
+}
+
+// layouts are the known schema versions, newest first
+var layouts = []Layout{
+	newLayout("MediaStream albumshare", []int{0}, Columns{
+		Albums:    "Albums",
+		AlbumGUID: "GUID",
+		AlbumName: "name",
+		AlbumURL:  "url",
+
+		Assets:         "AssetCollections",
+		AssetGUID:      "GUID",
+		AssetAlbumGUID: "albumGUID",
+		AssetBatchDate: "batchDate",
+		AssetNumber:    "photoNumber",
+		AssetPlist:     "obj",
+
+		Comments:         "Comments",
+		CommentGUID:      "GUID",
+		CommentAssetGUID: "assetCollectionGUID",
+		CommentTimestamp: "timestamp",
+		CommentIsCaption: "isCaption",
+		CommentIsMine:    "isMine",
+		CommentPlist:     "obj",
+	}),
+}
+
+// Schema is the layout of the open database, set by Detect
+var Schema = &layouts[0]
+
+// Version is the PRAGMA user_version of the open database, set by Detect
+var Version int
+
+// Detect reads the open database's schema version and picks the layout for it, checking the tables and
+// columns it maps to are all there. A version no layout lists is matched by its columns instead, and ok is false.
+// Unknown schemas are reported with what's missing, rather than read into zero values.
+func Detect() (layout *Layout, ok bool, err error) {
+	if Version, err = userVersion(); err != nil {
+		return nil, false, fmt.Errorf("could not read database version: %w", err)
+	}
+	tables, err := describe()
+	if err != nil {
+		return nil, false, fmt.Errorf("could not inspect database schema: %w", err)
+	}
+
+	for i := range layouts {
+		if !layouts[i].supports(Version) {
+			continue
+		}
+		if missing := layouts[i].missing(tables); len(missing) > 0 {
+			return nil, false, fmt.Errorf("database version %d should have the %s layout, but %s is missing: %s",
+				Version, layouts[i].Name, File, strings.Join(missing, ", "))
+		}
+		Schema = &layouts[i]
+		return Schema, true, nil
+	}
+
+	var closest []string
+	for i := range layouts {
+		missing := layouts[i].missing(tables)
+		if len(missing) == 0 {
+			Schema = &layouts[i]
+			return Schema, false, nil
+		}
+		if closest == nil || len(missing) < len(closest) {
+			closest = missing
+		}
+	}
+	return nil, false, fmt.Errorf("unsupported MediaStream database (user_version %d), is %s an album share Model.sqlite? Missing: %s",
+		Version, File, strings.Join(closest, ", "))
+}
+
+func (l *Layout) supports(version int) bool {
+	for _, v := range l.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// columns lists what the layout's queries read, by table
+func (l *Layout) columns() map[string][]string {
+	c := l.Columns
+	return map[string][]string{
+		c.Albums:   {c.AlbumGUID, c.AlbumName, c.AlbumURL},
+		c.Assets:   {c.AssetGUID, c.AssetAlbumGUID, c.AssetBatchDate, c.AssetNumber, c.AssetPlist},
+		c.Comments: {c.CommentGUID, c.CommentAssetGUID, c.CommentTimestamp, c.CommentIsCaption, c.CommentIsMine, c.CommentPlist},
+	}
+}
+
+func userVersion() (int, error) {
+	rows, err := Query("PRAGMA user_version")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version int
+	if rows.Next() {
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+	}
+	return version, rows.Err()
+}
+
+// missing lists the tables and columns the layout needs that tables lacks
+func (l *Layout) missing(tables map[string]map[string]bool) []string {
+	var out []string
+	for table, columns := range l.columns() {
+		found, ok := tables[strings.ToLower(table)]
+		if !ok {
+			out = append(out, "table "+table)
+			continue
+		}
+		for _, c := range columns {
+			if !found[strings.ToLower(c)] {
+				out = append(out, table+"."+c)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// describe returns the database's columns by table, lowercased as SQLite names are case insensitive
+func describe() (map[string]map[string]bool, error) {
+	rows, err := Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]map[string]bool, len(names))
+	for _, name := range names {
+		columns, err := Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", strings.ReplaceAll(name, "'", "''")))
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]bool)
+		for columns.Next() {
+			var column string
+			if err := columns.Scan(&column); err != nil {
+				columns.Close()
+				return nil, err
+			}
+			found[strings.ToLower(column)] = true
+		}
+		columns.Close()
+		if err := columns.Err(); err != nil {
+			return nil, err
+		}
+		tables[strings.ToLower(name)] = found
+	}
+	return tables, nil
+}
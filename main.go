@@ -1,25 +1,19 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/qcasey/airphoto-server/server"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
 )
 
 func init() {
-	defaultZone, err := time.LoadLocation("America/Los_Angeles")
-	if err != nil {
-		log.Panic().Msg(err.Error())
-	}
-
 	// Configure logging
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	zerolog.TimestampFunc = func() time.Time {
-		return time.Now().In(defaultZone)
-	}
 
 	output := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "Mon Jan 2 15:04:05"}
 	log.Logger = zerolog.New(output).With().Caller().Timestamp().Logger()
@@ -31,5 +25,19 @@ func main() {
 		log.Fatal().Err(err).Msg("Could not create new server")
 	}
 
+	// Log in the configured zone
+	zerolog.TimestampFunc = func() time.Time {
+		return time.Now().In(srv.Location)
+	}
+
+	// Subcommands inspect the database and exit
+	if args := pflag.Args(); len(args) > 0 {
+		if err := runCommand(srv, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	srv.Start(bindRoutes)
 }
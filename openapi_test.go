@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/apikey"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/comment"
+	"github.com/qcasey/airphoto-server/pkg/metadata"
+	"github.com/qcasey/airphoto-server/server"
+	"github.com/spf13/viper"
+)
+
+const testSecret = "contract-test"
+
+// testAlbums covers every field the spec documents: a photo with metadata, comments, a caption and a like,
+// a video without metadata, and an album without assets
+func testAlbums() []*album.Album {
+	taken := time.Date(2021, time.March, 14, 15, 9, 26, 535000000, time.UTC)
+	location := metadata.Location{Latitude: 37.7858, Longitude: -122.4064, Altitude: 12.3}
+
+	photo := &asset.Asset{
+		GUID:        "asset-photo",
+		AlbumGUID:   "album-1",
+		Date:        taken,
+		SortingDate: taken,
+		Day:         "2021-03-14",
+		BatchID:     "batch-1",
+		BatchDate:   taken,
+		Author:      "Jane Appleseed",
+		AuthorID:    "person-1",
+		IsMine:      true,
+		Filename:    "IMG_0001.JPG",
+		Filetype:    "public.jpeg",
+		MIME:        "image/jpeg",
+		Width:       4032,
+		Height:      3024,
+		Size:        2048000,
+		Number:      1,
+		Comments:    make(map[string]*comment.Comment),
+		Variants: []asset.Variant{
+			{GUID: "variant-1", Type: asset.VariantOriginal, Width: 4032, Height: 3024, Size: 2048000, Hash: "01ab", AvailableOnServer: true},
+			{GUID: "variant-2", Type: asset.VariantDerivative, Width: 2048, Height: 1536, Size: 512000, Hash: "02cd", AvailableOnServer: true},
+		},
+		Metadata: &metadata.Metadata{CaptureDate: &taken, CameraMake: "Apple", CameraModel: "iPhone 12", Orientation: 1, Location: &location},
+	}
+	for i, c := range []comment.Comment{
+		{GUID: "comment-caption", IsCaption: true, AuthorID: "person-1", AuthorName: "Jane Appleseed", AuthorEmail: "jane@example.com", Content: "Pi day"},
+		{GUID: "comment-text", AuthorID: "person-2", AuthorName: "John Appleseed", AuthorEmail: "john@example.com", Content: "Nice"},
+		{GUID: "comment-like", IsLike: true, AuthorID: "person-2", AuthorName: "John Appleseed"},
+	} {
+		c := c
+		c.AssetGUID = photo.GUID
+		c.Date = taken.Add(time.Duration(i+1) * time.Minute)
+		photo.Comments[c.Date.Format(time.RFC3339Nano)] = &c
+	}
+
+	video := &asset.Asset{
+		GUID:        "asset-video",
+		AlbumGUID:   "album-1",
+		Date:        taken.Add(time.Hour),
+		SortingDate: taken.Add(time.Hour),
+		Day:         "2021-03-14",
+		BatchID:     "batch-2",
+		BatchDate:   taken.Add(time.Hour),
+		Author:      "John Appleseed",
+		AuthorID:    "person-2",
+		IsVideo:     true,
+		Filename:    "IMG_0002.MOV",
+		Filetype:    "com.apple.quicktime-movie",
+		MIME:        "video/quicktime",
+		Comments:    make(map[string]*comment.Comment),
+	}
+
+	return []*album.Album{{
+		GUID:          "album-1",
+		Name:          "Trip",
+		URL:           "https://www.icloud.com/sharedalbum/#album-1",
+		LastPhotoDate: video.Date,
+		CoverPhoto:    photo.Filename,
+		CoverGUID:     photo.GUID,
+		Assets:        map[string]*asset.Asset{photo.GUID: photo, video.GUID: video},
+	}, {
+		GUID:          "album-2",
+		Name:          "Empty",
+		URL:           "https://www.icloud.com/sharedalbum/#album-2",
+		LastPhotoDate: taken,
+		Assets:        make(map[string]*asset.Asset),
+	}}
+}
+
+func testRouter(t *testing.T) *mux.Router {
+	srv := &server.Server{Viper: viper.New(), Albums: testAlbums(), Location: time.UTC}
+	var err error
+	srv.Keys, err = apikey.Open(filepath.Join(t.TempDir(), "keys.json"), []apikey.Key{
+		{Name: "test", Secret: testSecret, Scopes: []string{apikey.ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter().StrictSlash(true)
+	bindRoutes(srv, r)
+	return r
+}
+
+// get requests path with the test key, followed by any header name and value pairs
+func get(r http.Handler, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testSecret)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// TestOpenAPIContract checks every documented path is routed to its own handler,
+// and that the handler's response matches the documented schema
+func TestOpenAPIContract(t *testing.T) {
+	r := testRouter(t)
+
+	w := get(r, "/openapi.json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: status %d", w.Code)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+
+	paths := spec["paths"].(map[string]interface{})
+	if len(paths) == 0 {
+		t.Fatal("spec documents no paths")
+	}
+	for path, item := range paths {
+		for method, op := range item.(map[string]interface{}) {
+			if method != "get" {
+				t.Errorf("%s %s: only GET is covered by this test", strings.ToUpper(method), path)
+				continue
+			}
+			url := strings.ReplaceAll(path, "{guid}", "album-1")
+
+			// gorilla/mux matches in registration order, so a broader route can shadow a documented one
+			var match mux.RouteMatch
+			if !r.Match(httptest.NewRequest(http.MethodGet, url, nil), &match) {
+				t.Errorf("GET %s: no route", path)
+				continue
+			}
+			if template, _ := match.Route.GetPathTemplate(); template != path {
+				t.Errorf("GET %s: routed to %s", path, template)
+				continue
+			}
+
+			w := get(r, url)
+			if w.Code != http.StatusOK {
+				t.Errorf("GET %s: status %d", url, w.Code)
+				continue
+			}
+			var body interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("GET %s: invalid JSON: %v", url, err)
+				continue
+			}
+
+			responses := op.(map[string]interface{})["responses"].(map[string]interface{})
+			ok := responses["200"].(map[string]interface{})
+			schema := ok["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"]
+			for _, problem := range validate(spec, schema.(map[string]interface{}), body, "body") {
+				t.Errorf("GET %s: %s", url, problem)
+			}
+
+			if _, documented := responses["304"]; documented {
+				if w := get(r, url, "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+					t.Errorf("GET %s with a current ETag: status %d", url, w.Code)
+				}
+			}
+		}
+	}
+}
+
+// validate checks value against an OpenAPI schema, returning what doesn't match.
+// Properties a schema doesn't list are reported, so new fields can't go undocumented.
+func validate(spec map[string]interface{}, schema map[string]interface{}, value interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return validate(spec, resolve(spec, ref), value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + " is null"}
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		var problems []string
+		for _, s := range all {
+			problems = append(problems, validate(spec, s.(map[string]interface{}), value, at)...)
+		}
+		return problems
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not an object", at, value)}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", at, name))
+			}
+		}
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := properties[k]; ok {
+				problems = append(problems, validate(spec, p.(map[string]interface{}), object[k], at+"."+k)...)
+			} else if additional != nil {
+				problems = append(problems, validate(spec, additional, object[k], at+"["+k+"]")...)
+			} else {
+				problems = append(problems, fmt.Sprintf("%s.%s is not documented", at, k))
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not an array", at, value)}
+		}
+		items := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			problems = append(problems, validate(spec, items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not a string", at, value)}
+		}
+		layout := map[interface{}]string{"date-time": time.RFC3339Nano, "date": asset.DayFormat}[schema["format"]]
+		if _, err := time.Parse(layout, s); layout != "" && err != nil {
+			problems = append(problems, fmt.Sprintf("%s is not a %s: %q", at, schema["format"], s))
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return []string{fmt.Sprintf("%s is not an integer", at)}
+		}
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			problems = append(problems, fmt.Sprintf("%s is below %v", at, min))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s is %T, not a number", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s is %T, not a boolean", at, value))
+		}
+	}
+	return problems
+}
+
+// resolve follows a local reference such as "#/components/schemas/Album"
+func resolve(spec map[string]interface{}, ref string) map[string]interface{} {
+	node := spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node = node[part].(map[string]interface{})
+	}
+	return node
+}
@@ -0,0 +1,96 @@
+package activity
+
+import (
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+)
+
+// Event types emitted in the activity timeline
+const (
+	TypeAsset   = "asset"
+	TypeComment = "comment"
+	TypeCaption = "caption"
+	TypeLike    = "like"
+)
+
+// Event is a single entry in the activity timeline, with enough album context to render on its own
+type Event struct {
+	GUID      string    `json:"GUID"`
+	Type      string    `json:"Type"`
+	Date      time.Time `json:"Date"`
+	AlbumGUID string    `json:"AlbumGUID"`
+	AlbumName string    `json:"AlbumName"`
+	AssetGUID string    `json:"AssetGUID"`
+	Filename  string    `json:"Filename"`
+	IsVideo   bool      `json:"IsVideo"`
+	Author    string    `json:"Author"`
+	AuthorID  string    `json:"AuthorID"`
+	IsMine    bool      `json:"IsMine"`
+	Content   string    `json:"Content,omitempty"`
+}
+
+// List for sorting events
+type List []Event
+
+// Len is part of sort.Interface.
+func (a List) Len() int {
+	return len(a)
+}
+
+// Swap is part of sort.Interface.
+func (a List) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+// Less is part of sort.Interface. Newest events come first
+func (a List) Less(i, j int) bool {
+	return a[i].Date.After(a[j].Date)
+}
+
+// FromAlbums flattens the assets and comments of every album into an unsorted list of events
+func FromAlbums(albums []*album.Album) List {
+	out := make(List, 0)
+	for _, al := range albums {
+		for _, as := range al.Assets {
+			out = append(out, Event{
+				GUID:      as.GUID,
+				Type:      TypeAsset,
+				Date:      as.Date,
+				AlbumGUID: al.GUID,
+				AlbumName: al.Name,
+				AssetGUID: as.GUID,
+				Filename:  as.Filename,
+				IsVideo:   as.IsVideo,
+				Author:    as.Author,
+				AuthorID:  as.AuthorID,
+				IsMine:    as.IsMine,
+			})
+
+			for _, c := range as.Comments {
+				e := Event{
+					GUID:      c.GUID,
+					Type:      TypeComment,
+					Date:      c.Date,
+					AlbumGUID: al.GUID,
+					AlbumName: al.Name,
+					AssetGUID: as.GUID,
+					Filename:  as.Filename,
+					IsVideo:   as.IsVideo,
+					Author:    c.AuthorName,
+					AuthorID:  c.AuthorID,
+					IsMine:    c.IsMine,
+					Content:   c.Content,
+				}
+				switch {
+				case c.IsLike:
+					e.Type = TypeLike
+				case c.IsCaption:
+					e.Type = TypeCaption
+				}
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
@@ -17,6 +17,7 @@ type Album struct {
 	URL           string                  `json:"URL"`
 	LastPhotoDate time.Time               `json:"LastPhotoDate"`
 	CoverPhoto    string                  `json:"CoverPhoto"`
+	CoverGUID     string                  `json:"CoverGUID"`
 	Assets        map[string]*asset.Asset `json:"Assets"`
 }
 
@@ -38,33 +39,74 @@ func (a List) Less(i, j int) bool {
 	return a[i].LastPhotoDate.After(a[j].LastPhotoDate)
 }
 
-func parseAlbumRows(rows *sql.Rows) []*Album {
+// In returns a copy of the album and its assets with all dates converted to loc
+func (a Album) In(loc *time.Location) Album {
+	a.LastPhotoDate = a.LastPhotoDate.In(loc)
+	if a.Assets != nil {
+		assets := make(map[string]*asset.Asset, len(a.Assets))
+		for guid, as := range a.Assets {
+			localized := as.In(loc)
+			assets[guid] = &localized
+		}
+		a.Assets = assets
+	}
+	return a
+}
+
+func parseAlbumRows(rows *sql.Rows) ([]*Album, error) {
 	var out []*Album
 	if rows == nil {
-		return out
+		return out, nil
 	}
 	defer rows.Close()
 	for rows.Next() {
 		c := Album{}
-		rows.Scan(&c.GUID, &c.Name, &c.URL)
+		var name, url sql.NullString
+		if err := rows.Scan(&c.GUID, &name, &url); err != nil {
+			return nil, fmt.Errorf("could not read album row: %w", err)
+		}
+		c.Name, c.URL = name.String, url.String
 		out = append(out, &c)
 	}
-	return out
+	return out, rows.Err()
+}
+
+// GetAlbumList reads every album without its assets
+func GetAlbumList() ([]*Album, error) {
+	rows, err := database.Query(database.Schema.Albums)
+	if err != nil {
+		return nil, err
+	}
+	return parseAlbumRows(rows)
 }
 
-func GetAlbums(isRefresh bool) ([]*Album, error) {
-	rows, err := database.Query("SELECT GUID, name, url FROM Albums")
+// GetAlbums reads every album with its assets. previous holds the albums as last read, possibly nil,
+// and stands in for assets and comments that can't be read this time. Days are bucketed in loc.
+// Whatever can't be read fails the read or keeps its previous state rather than being left out,
+// since the journal, mirror and notifications take a missing album, asset or comment as deleted.
+func GetAlbums(isRefresh bool, previous []*Album, loc *time.Location) ([]*Album, error) {
+	newAlbums, err := GetAlbumList()
 	if err != nil {
 		return nil, err
 	}
-	newAlbums := parseAlbumRows(rows)
+
+	previousAssets := make(map[string]map[string]*asset.Asset, len(previous))
+	for _, a := range previous {
+		previousAssets[a.GUID] = a.Assets
+	}
 
 	for _, Album := range newAlbums {
 		log.Info().Msg(fmt.Sprintf("Parsing album %s (%s)", Album.Name, Album.GUID))
 
 		var mostRecentAsset *asset.Asset
-		Album.Assets, mostRecentAsset = asset.GetAssets(Album.GUID, isRefresh)
-		Album.LastPhotoDate, Album.CoverPhoto = mostRecentAsset.SortingDate, mostRecentAsset.Filename
+		Album.Assets, mostRecentAsset, err = asset.GetAssets(Album.GUID, isRefresh, previousAssets[Album.GUID], loc)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the assets of album %s: %w", Album.GUID, err)
+		}
+		if mostRecentAsset != nil {
+			Album.LastPhotoDate, Album.CoverPhoto = mostRecentAsset.SortingDate, mostRecentAsset.Filename
+			Album.CoverGUID = mostRecentAsset.GUID
+		}
 	}
 
 	log.Info().Msg(fmt.Sprintf("Parsed %d albums.", len(newAlbums)))
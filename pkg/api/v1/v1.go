@@ -0,0 +1,246 @@
+// Package v1 holds the response types of the /v1 API.
+// Fields may be added, but never renamed or removed; breaking changes belong in a new version.
+package v1
+
+import (
+	"sort"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/comment"
+	"github.com/qcasey/airphoto-server/pkg/media"
+	"github.com/qcasey/airphoto-server/pkg/metadata"
+)
+
+// Album is a shared album without its assets
+type Album struct {
+	GUID           string    `json:"guid"`
+	Name           string    `json:"name"`
+	URL            string    `json:"url"`
+	LastPhotoDate  time.Time `json:"lastPhotoDate"`
+	CoverAssetGUID string    `json:"coverAssetGUID,omitempty"`
+	AssetCount     int       `json:"assetCount"`
+}
+
+// AlbumWithAssets is an album along with all of its assets, which are always encoded, as [] when there are none
+type AlbumWithAssets struct {
+	Album
+	Assets []Asset `json:"assets"`
+}
+
+// Person is the author of an asset or comment
+type Person struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Asset is a photo or video, its comments are oldest first
+type Asset struct {
+	GUID         string    `json:"guid"`
+	AlbumGUID    string    `json:"albumGUID"`
+	Date         time.Time `json:"date"`
+	SortingDate  time.Time `json:"sortingDate"`
+	Day          string    `json:"day"`
+	BatchID      string    `json:"batchID"`
+	BatchDate    time.Time `json:"batchDate"`
+	Author       Person    `json:"author"`
+	IsMine       bool      `json:"isMine"`
+	IsVideo      bool      `json:"isVideo"`
+	Filename     string    `json:"filename"`
+	MIME         string    `json:"mime"`
+	Width        uint64    `json:"width"`
+	Height       uint64    `json:"height"`
+	Size         uint64    `json:"size"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailURL"`
+	Variants     []Variant `json:"variants"`
+	Metadata     *Metadata `json:"metadata,omitempty"`
+	Comments     []Comment `json:"comments"`
+}
+
+// Variant is one stored rendition of an asset
+type Variant struct {
+	GUID              string `json:"guid"`
+	Type              string `json:"type"`
+	Width             uint64 `json:"width"`
+	Height            uint64 `json:"height"`
+	Size              uint64 `json:"size"`
+	Hash              string `json:"hash"`
+	AvailableOnServer bool   `json:"availableOnServer"`
+}
+
+// Metadata is what was read from the asset's media file
+type Metadata struct {
+	CaptureDate *time.Time `json:"captureDate,omitempty"`
+	CameraMake  string     `json:"cameraMake,omitempty"`
+	CameraModel string     `json:"cameraModel,omitempty"`
+	Orientation int        `json:"orientation,omitempty"`
+	Location    *Location  `json:"location,omitempty"`
+	Duration    float64    `json:"duration,omitempty"` // in seconds, videos only
+	Codec       string     `json:"codec,omitempty"`
+}
+
+// Location is a WGS84 coordinate, altitude is in meters
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude,omitempty"`
+}
+
+// Comment is a comment, caption or like on an asset
+type Comment struct {
+	GUID      string    `json:"guid"`
+	AssetGUID string    `json:"assetGUID"`
+	Date      time.Time `json:"date"`
+	Author    Person    `json:"author"`
+	IsMine    bool      `json:"isMine"`
+	IsCaption bool      `json:"isCaption"`
+	IsLike    bool      `json:"isLike"`
+	Content   string    `json:"content"`
+}
+
+// Delta is what changed since a sync cursor, newest state only.
+// Assets carry all of their current comments, Comments lists the ones that changed on their own.
+type Delta struct {
+	Cursor string `json:"cursor"`
+	// Full means the delta is a complete copy, the client should drop what it has first
+	Full     bool        `json:"full"`
+	Albums   []Album     `json:"albums"`
+	Assets   []Asset     `json:"assets"`
+	Comments []Comment   `json:"comments"`
+	Deleted  []Tombstone `json:"deleted"`
+}
+
+// Tombstone marks an album, asset or comment that no longer exists
+type Tombstone struct {
+	Type      string    `json:"type"`
+	GUID      string    `json:"guid"`
+	AlbumGUID string    `json:"albumGUID,omitempty"`
+	AssetGUID string    `json:"assetGUID,omitempty"`
+	Date      time.Time `json:"date"`
+}
+
+// NewDelta returns an empty delta, encoding its lists as [] rather than null
+func NewDelta(cursor string, full bool) Delta {
+	return Delta{
+		Cursor:   cursor,
+		Full:     full,
+		Albums:   []Album{},
+		Assets:   []Asset{},
+		Comments: []Comment{},
+		Deleted:  []Tombstone{},
+	}
+}
+
+// NewAlbum converts an album without its assets, with dates in loc
+func NewAlbum(a *album.Album, loc *time.Location) Album {
+	return Album{
+		GUID:           a.GUID,
+		Name:           a.Name,
+		URL:            a.URL,
+		LastPhotoDate:  a.LastPhotoDate.In(loc),
+		CoverAssetGUID: a.CoverGUID,
+		AssetCount:     len(a.Assets),
+	}
+}
+
+// NewAlbumWithAssets converts an album and all of its assets, newest first
+func NewAlbumWithAssets(a *album.Album, loc *time.Location) AlbumWithAssets {
+	return AlbumWithAssets{Album: NewAlbum(a, loc), Assets: NewAssets(a.Assets, loc, nil)}
+}
+
+// NewAssets converts the assets passing include, newest first. A nil include passes everything.
+func NewAssets(assets map[string]*asset.Asset, loc *time.Location, include func(*asset.Asset) bool) []Asset {
+	sorted := make(asset.List, 0, len(assets))
+	for _, a := range assets {
+		if include == nil || include(a) {
+			sorted = append(sorted, *a)
+		}
+	}
+	sort.Sort(sorted)
+
+	out := make([]Asset, 0, len(sorted))
+	for i := range sorted {
+		out = append(out, NewAsset(&sorted[i], loc))
+	}
+	return out
+}
+
+// NewAsset converts an asset and its comments, with dates in loc
+func NewAsset(a *asset.Asset, loc *time.Location) Asset {
+	out := Asset{
+		GUID:         a.GUID,
+		AlbumGUID:    a.AlbumGUID,
+		Date:         a.Date.In(loc),
+		SortingDate:  a.SortingDate.In(loc),
+		Day:          a.Day,
+		BatchID:      a.BatchID,
+		BatchDate:    a.BatchDate.In(loc),
+		Author:       Person{ID: a.AuthorID, Name: a.Author},
+		IsMine:       a.IsMine,
+		IsVideo:      a.IsVideo,
+		Filename:     a.Filename,
+		MIME:         a.MIME,
+		Width:        a.Width,
+		Height:       a.Height,
+		Size:         a.Size,
+		URL:          media.FileURL(a.AlbumGUID, a.GUID, ""),
+		ThumbnailURL: media.FileURL(a.AlbumGUID, a.GUID, asset.VariantDerivative),
+		Variants:     make([]Variant, 0, len(a.Variants)),
+		Comments:     make([]Comment, 0, len(a.Comments)),
+	}
+
+	for _, v := range a.Variants {
+		out.Variants = append(out.Variants, Variant{
+			GUID:              v.GUID,
+			Type:              v.Type,
+			Width:             v.Width,
+			Height:            v.Height,
+			Size:              v.Size,
+			Hash:              v.Hash,
+			AvailableOnServer: v.AvailableOnServer,
+		})
+	}
+	if a.Metadata != nil {
+		m := newMetadata(a.Metadata.In(loc))
+		out.Metadata = &m
+	}
+
+	for _, c := range a.Comments {
+		out.Comments = append(out.Comments, NewComment(c, loc))
+	}
+	sort.Slice(out.Comments, func(i, j int) bool {
+		return out.Comments[i].Date.Before(out.Comments[j].Date)
+	})
+	return out
+}
+
+// NewComment converts a comment, with its date in loc
+func NewComment(c *comment.Comment, loc *time.Location) Comment {
+	return Comment{
+		GUID:      c.GUID,
+		AssetGUID: c.AssetGUID,
+		Date:      c.Date.In(loc),
+		Author:    Person{ID: c.AuthorID, Name: c.AuthorName},
+		IsMine:    c.IsMine,
+		IsCaption: c.IsCaption,
+		IsLike:    c.IsLike,
+		Content:   c.Content,
+	}
+}
+
+func newMetadata(m metadata.Metadata) Metadata {
+	out := Metadata{
+		CaptureDate: m.CaptureDate,
+		CameraMake:  m.CameraMake,
+		CameraModel: m.CameraModel,
+		Orientation: m.Orientation,
+		Duration:    m.Duration,
+		Codec:       m.Codec,
+	}
+	if m.Location != nil {
+		out.Location = &Location{Latitude: m.Location.Latitude, Longitude: m.Location.Longitude, Altitude: m.Location.Altitude}
+	}
+	return out
+}
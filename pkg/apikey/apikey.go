@@ -0,0 +1,302 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scopes a key can be granted
+const (
+	ScopeAlbums  = "albums"  // read albums, assets, comments and everything derived from them
+	ScopeMedia   = "media"   // read media files and exports
+	ScopeDevices = "devices" // register devices for notifications
+	ScopeAdmin   = "admin"   // manage share links and keys, implies every other scope
+)
+
+// Sources a key can come from
+const (
+	SourceConfig = "config"
+	SourceAdmin  = "admin"
+)
+
+var (
+	// ErrExists is returned when creating a key whose name is taken
+	ErrExists = errors.New("a key with that name already exists")
+	// ErrNotFound is returned for unknown key names
+	ErrNotFound = errors.New("key not found")
+	// ErrReadOnly is returned when deleting a key defined in the config
+	ErrReadOnly = errors.New("key is defined in the config")
+	// ErrInvalidScope is returned for scopes that don't exist
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// Key is a named API key. Only a hash of its secret is kept.
+type Key struct {
+	Name   string   `json:"Name" mapstructure:"name"`
+	Scopes []string `json:"Scopes" mapstructure:"scopes"`
+	// Albums restricts the key to these album GUIDs, empty allows all
+	Albums []string `json:"Albums" mapstructure:"albums"`
+
+	// Secret is only set when reading keys from the config
+	Secret string `json:"-" mapstructure:"key"`
+
+	Hash      string    `json:"Hash,omitempty"`
+	Source    string    `json:"Source"`
+	CreatedAt time.Time `json:"CreatedAt"`
+}
+
+// Allows reports whether the key was granted scope
+func (k Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAlbum reports whether the key may see an album
+func (k Key) AllowsAlbum(guid string) bool {
+	if len(k.Albums) == 0 {
+		return true
+	}
+	for _, a := range k.Albums {
+		if a == guid {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether k grants everything other does, so a key can't hand out more than it has
+func (k Key) Covers(other Key) bool {
+	for _, s := range other.Scopes {
+		if !k.Allows(s) {
+			return false
+		}
+	}
+	if len(k.Albums) == 0 {
+		return true
+	}
+	if len(other.Albums) == 0 {
+		return false
+	}
+	for _, a := range other.Albums {
+		if !k.AllowsAlbum(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// Usage counts the requests made with a key
+type Usage struct {
+	Requests int64     `json:"Requests"`
+	LastUsed time.Time `json:"LastUsed"`
+}
+
+// Info is a key and its usage, as listed to admins
+type Info struct {
+	Key
+	Usage Usage `json:"Usage"`
+}
+
+// Store holds the configured keys and those created through the admin endpoints, persisting the latter
+type Store struct {
+	path  string
+	keys  map[string]Key
+	usage map[string]*Usage
+	mutex sync.RWMutex
+}
+
+// Open loads admin created keys from path and merges in the configured ones, which take precedence
+func Open(path string, configured []Key) (*Store, error) {
+	s := &Store{path: path, keys: make(map[string]Key), usage: make(map[string]*Usage)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var stored []Key
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("corrupt key store: %w", err)
+		}
+		for _, k := range stored {
+			s.keys[k.Name] = k
+		}
+	}
+
+	for _, k := range configured {
+		if k.Name == "" || k.Secret == "" {
+			return nil, errors.New("configured API keys need a name and a key")
+		}
+		if err := validScopes(k.Scopes); err != nil {
+			return nil, fmt.Errorf("API key %s: %w", k.Name, err)
+		}
+		k.Hash, k.Secret, k.Source = hash(k.Secret), "", SourceConfig
+		s.keys[k.Name] = k
+	}
+
+	for name := range s.keys {
+		s.usage[name] = &Usage{}
+	}
+	return s, nil
+}
+
+// Empty reports whether no keys exist
+func (s *Store) Empty() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.keys) == 0
+}
+
+// Authenticate finds the key matching secret and records its use
+func (s *Store) Authenticate(secret string) (Key, bool) {
+	if secret == "" {
+		return Key{}, false
+	}
+	presented := []byte(hash(secret))
+
+	s.mutex.RLock()
+	var (
+		found Key
+		ok    bool
+	)
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(presented, []byte(k.Hash)) == 1 {
+			found, ok = k, true
+		}
+	}
+	s.mutex.RUnlock()
+	if !ok {
+		return Key{}, false
+	}
+
+	s.mutex.Lock()
+	if u, exists := s.usage[found.Name]; exists {
+		u.Requests++
+		u.LastUsed = time.Now().UTC()
+	}
+	s.mutex.Unlock()
+	return found, true
+}
+
+// Create adds a key and returns it with its secret, which is shown only this once
+func (s *Store) Create(name string, scopes []string, albums []string) (Key, string, error) {
+	if name == "" {
+		return Key{}, "", errors.New("a key needs a name")
+	}
+	if err := validScopes(scopes); err != nil {
+		return Key{}, "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.keys[name]; exists {
+		return Key{}, "", ErrExists
+	}
+
+	secret := randomHex(24)
+	k := Key{
+		Name:      name,
+		Scopes:    scopes,
+		Albums:    albums,
+		Hash:      hash(secret),
+		Source:    SourceAdmin,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.keys[name] = k
+	s.usage[name] = &Usage{}
+	return k, secret, s.save()
+}
+
+// Delete removes an admin created key
+func (s *Store) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k, ok := s.keys[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if k.Source == SourceConfig {
+		return ErrReadOnly
+	}
+	delete(s.keys, name)
+	delete(s.usage, name)
+	return s.save()
+}
+
+// List returns every key with its usage, by name
+func (s *Store) List() []Info {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	out := make([]Info, 0, len(s.keys))
+	for name, k := range s.keys {
+		k.Hash = ""
+		out = append(out, Info{Key: k, Usage: *s.usage[name]})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// save writes the admin created keys. The caller must hold the lock.
+func (s *Store) save() error {
+	stored := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		if k.Source == SourceAdmin {
+			stored = append(stored, k)
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func validScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeAlbums, ScopeMedia, ScopeDevices, ScopeAdmin:
+		default:
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
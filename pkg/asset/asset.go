@@ -1,9 +1,12 @@
 package asset
 
 import (
+	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"mime"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/nozzle/throttler"
 	"github.com/qcasey/airphoto-server/internal/database"
 	"github.com/qcasey/airphoto-server/pkg/comment"
+	"github.com/qcasey/airphoto-server/pkg/metadata"
 	"github.com/qcasey/nskeyedarchiver"
 	"github.com/rs/zerolog/log"
 )
@@ -23,6 +27,9 @@ type Asset struct {
 	AlbumGUID   string    `json:"AlbumGUID"`
 	Date        time.Time `json:"Date" mapstructure:"timestamp"`
 	SortingDate time.Time `json:"SortingDate"`
+	Day         string    `json:"Day"`
+	BatchID     string    `json:"BatchID"`
+	BatchDate   time.Time `json:"BatchDate"`
 	Author      string    `json:"Author" mapstructure:"fullName"`
 	AuthorID    string    `json:"AuthorID" mapstructure:"personID"`
 	IsMine      bool      `json:"IsMine"`
@@ -32,16 +39,93 @@ type Asset struct {
 	MIME        string    `json:"MIME"`
 	Width       uint64    `json:"Width"`
 	Height      uint64    `json:"Height"`
+	Size        uint64    `json:"Size"`
 	//Date       float64             `json:"Date"`
 	//BatchDate       float64             `json:"BatchDate"`
 	Number float64 `json:"PhotoNumber" mapstructure:"photoNumber"`
 	//LastCommentDate time.Time           `json:"LastCommentDate"`
 	Comments map[string]*comment.Comment `json:"Comments"`
+	Variants []Variant                   `json:"Variants"`
+	Metadata *metadata.Metadata          `json:"Metadata"`
 
-	PlistAssetData []plistAsset `mapstructure:"assets"`
+	PlistAssetData []plistAsset `json:"-" mapstructure:"assets"`
 	//Other    map[string]interface{}      `mapstructure:",remain"`
 }
 
+// ShowProgress draws a progress bar on stdout while assets are parsed
+var ShowProgress = true
+
+// DayFormat is the layout of Asset.Day
+const DayFormat = "2006-01-02"
+
+// In returns a copy of the asset and its comments with all dates converted to loc.
+// Day stays bucketed in the zone the asset was read in so groupings don't shift between requests.
+func (a Asset) In(loc *time.Location) Asset {
+	a.Date = a.Date.In(loc)
+	a.SortingDate = a.SortingDate.In(loc)
+	a.BatchDate = a.BatchDate.In(loc)
+	if a.Metadata != nil {
+		localized := a.Metadata.In(loc)
+		a.Metadata = &localized
+	}
+
+	comments := make(map[string]*comment.Comment, len(a.Comments))
+	for key, c := range a.Comments {
+		localized := c.In(loc)
+		comments[key] = &localized
+	}
+	a.Comments = comments
+	return a
+}
+
+// Comment finds a comment by GUID, Comments is keyed by date
+func (a *Asset) Comment(guid string) (*comment.Comment, bool) {
+	for _, c := range a.Comments {
+		if c.GUID == guid {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// HasLocation reports whether the asset's media file is geotagged
+func (a *Asset) HasLocation() bool {
+	return a.Metadata != nil && a.Metadata.Location != nil
+}
+
+// Variant types as found in the asset plist
+const (
+	VariantOriginal   = "original"
+	VariantDerivative = "derivative"
+)
+
+// Variant is one stored rendition of an asset, such as the original or a derivative
+type Variant struct {
+	GUID              string `json:"GUID"`
+	Type              string `json:"Type"`
+	Width             uint64 `json:"Width"`
+	Height            uint64 `json:"Height"`
+	Size              uint64 `json:"Size"`
+	Hash              string `json:"Hash"`
+	AvailableOnServer bool   `json:"AvailableOnServer"`
+}
+
+// Variant finds a rendition by type or GUID. An empty key prefers the original, then the first variant.
+func (a *Asset) Variant(key string) (Variant, bool) {
+	for _, v := range a.Variants {
+		if key == "" && v.Type == VariantOriginal {
+			return v, true
+		}
+		if key != "" && (v.Type == key || v.GUID == key) {
+			return v, true
+		}
+	}
+	if key == "" && len(a.Variants) > 0 {
+		return a.Variants[0], true
+	}
+	return Variant{}, false
+}
+
 // These are for decoding mapstructures of unarchived plists
 type plistAssetMetadata struct {
 	MSAssetMetadataAssetType      string
@@ -78,7 +162,8 @@ func (a List) Less(i, j int) bool {
 	return a[i].SortingDate.After(a[j].SortingDate)
 }
 
-func parseComments(asset *Asset, isRefresh bool) int {
+// parseComments reads the comments of an asset and dates it by its latest activity
+func parseComments(asset *Asset, isRefresh bool) (int, error) {
 	newCommentCount := 0
 
 	// Skip comment parsing on old comments
@@ -101,7 +186,11 @@ func parseComments(asset *Asset, isRefresh bool) int {
 				}
 			}
 		} else {*/
-	asset.Comments = comment.GetComments(string(asset.GUID), nil)
+	comments, err := comment.GetComments(string(asset.GUID), nil)
+	if err != nil {
+		return 0, err
+	}
+	asset.Comments = comments
 	newCommentCount = len(asset.Comments)
 
 	// Determine sorting date
@@ -116,7 +205,7 @@ func parseComments(asset *Asset, isRefresh bool) int {
 	}
 	//}
 
-	return newCommentCount
+	return newCommentCount, nil
 }
 
 // Get group Assets?
@@ -125,103 +214,232 @@ func parseComments(asset *Asset, isRefresh bool) int {
 // For a different sqlite file
 // "SELECT Z_PK, ZENTRY, ZASSETALBUMGUID, ZASSETGUID, ZASSETINFO FROM ZCLOUDFEEDENTRYASSET ORDER BY Z_PK DESC LIMIT 250"
 
-// GetAssets returns all assets included within a specific album
-func GetAssets(albumGUID string, isRefresh bool) (map[string]*Asset, *Asset) {
+// GetPlist returns the decoded plist an asset was parsed from
+func GetPlist(guid string) ([]interface{}, error) {
+	rows, err := database.Query(database.Schema.AssetPlist, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	var embeddedPlist []byte
+	if err := rows.Scan(&embeddedPlist); err != nil {
+		return nil, err
+	}
+	return nskeyedarchiver.Unarchive(embeddedPlist)
+}
+
+// Count returns the number of assets in an album without reading them
+func Count(albumGUID string) (int, error) {
+	rows, err := database.Query(database.Schema.AssetCount, albumGUID)
+	if err != nil {
+		return 0, err
+	}
+	// An open result would keep a snapshot's transaction from ending
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, fmt.Errorf("counting assets: %w", err)
+		}
+	}
+	return count, rows.Err()
+}
+
+// GetAssets returns all assets included within a specific album, along with the most recent one.
+// Days are bucketed in loc. previous holds the album's assets as last read, possibly nil, see readAsset.
+func GetAssets(albumGUID string, isRefresh bool, previous map[string]*Asset, loc *time.Location) (map[string]*Asset, *Asset, error) {
 	var (
 		mostRecentAsset *Asset
 		newAssetCount   int
 	)
 
-	// Get count
-	sqlCount := fmt.Sprintf("SELECT COUNT(*) FROM AssetCollections WHERE albumGUID = \"%s\"", albumGUID)
-	rows, errCount := database.Query(sqlCount)
-	if errCount != nil {
-		log.Error().Msg(errCount.Error())
-		return nil, nil
-	}
-	if rows.Next() {
-		rows.Scan(&newAssetCount)
+	newAssetCount, err := Count(albumGUID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	sql := fmt.Sprintf("SELECT albumGUID, GUID, batchDate, photoNumber, obj FROM AssetCollections WHERE albumGUID = \"%s\" ORDER BY batchDate DESC", albumGUID)
-	rows, err := database.Query(sql)
+	rows, err := database.Query(database.Schema.Assets, albumGUID)
 	if err != nil {
-		log.Error().Msg(err.Error())
-		return nil, nil
+		return nil, nil, err
 	}
 
 	defer rows.Close()
 
 	assetMap := make(map[string]*Asset, 0) // for returning new assets
-	var assetMutex sync.Mutex
+	var (
+		assetMutex sync.Mutex
+		parsing    sync.WaitGroup
+		readErr    error
+	)
 
 	// For program counting
 	start := time.Now()
-	bar := pb.StartNew(newAssetCount)
+	bar := pb.New(newAssetCount)
+	bar.NotPrint = !ShowProgress
+	bar.Start()
 	t := throttler.New(6, newAssetCount)
 
 	for rows.Next() {
 		asset := &Asset{Comments: make(map[string]*comment.Comment, 0)}
 		var (
-			appleTime     float64
+			appleTime     sql.NullFloat64
+			number        sql.NullFloat64
 			embeddedPlist []byte
 		)
-		rows.Scan(&asset.AlbumGUID, &asset.GUID, &appleTime, &asset.Number, &embeddedPlist)
-
-		// Parse date before throwing away appleTime
-		if parsedDate, err := nskeyedarchiver.NSDateToTime(appleTime); err == nil {
-			asset.Date = parsedDate
+		if err = rows.Scan(&asset.AlbumGUID, &asset.GUID, &appleTime, &number, &embeddedPlist); err != nil {
+			err = fmt.Errorf("reading asset row: %w", err)
+			break
+		}
+		asset.Number = number.Float64
+
+		// Assets uploaded together share a batchDate, use it as the batch's identity.
+		// Without one, an asset is a batch of its own.
+		asset.BatchID = asset.GUID
+		if appleTime.Valid {
+			asset.BatchID = strconv.FormatFloat(appleTime.Float64, 'f', -1, 64)
+
+			// Parse date before throwing away appleTime
+			if parsedDate, err := nskeyedarchiver.NSDateToTime(appleTime.Float64); err == nil {
+				asset.Date = parsedDate
+				asset.BatchDate = parsedDate.UTC()
+			}
 		}
 
+		parsing.Add(1)
 		go func(asset *Asset, embeddedPlist []byte) {
-
-			plistData, err := nskeyedarchiver.Unarchive(embeddedPlist)
-			if err != nil {
-				fmt.Println("Error decoding plist:", err)
-				return
-			}
-			plistMap := plistData[0].(map[string]interface{})
-			err = mapstructure.Decode(plistMap, &asset)
+			defer parsing.Done()
+			asset, err := readAsset(asset, embeddedPlist, previous[asset.GUID], isRefresh, loc)
+			assetMutex.Lock()
 			if err != nil {
-				fmt.Println("Error mapping plist:", err)
-				return
-			}
-
-			// Parse metadata
-			asset.Filetype = strings.ToLower(filepath.Ext(asset.Filename))
-			asset.MIME = mime.TypeByExtension(asset.Filetype)
-			asset.IsVideo = asset.Filetype == ".mp4" || asset.Filetype == ".mov"
-
-			// Graduate plist asset to main height/width data
-			for _, a := range asset.PlistAssetData {
-				if a.Metadata.MSAssetMetadataAssetType == "derivative" {
-					asset.Height = a.Metadata.MSAssetMetadataPixelHeight
-					asset.Width = a.Metadata.MSAssetMetadataPixelWidth
-					break
+				if readErr == nil {
+					readErr = err
+				}
+			} else {
+				assetMap[asset.GUID] = asset
+				// Check date of this asset, update most recent
+				if mostRecentAsset == nil || (!asset.IsVideo && asset.SortingDate.After(mostRecentAsset.SortingDate)) {
+					mostRecentAsset = asset
 				}
 			}
-
-			parseComments(asset, isRefresh)
-
-			assetMutex.Lock()
-			assetMap[asset.GUID] = asset
 			assetMutex.Unlock()
 
-			// Check date of this asset, update most recent
-			if mostRecentAsset == nil || (!asset.IsVideo && asset.SortingDate.After(mostRecentAsset.SortingDate)) {
-				mostRecentAsset = asset
-			}
-
-			// Mark as done
+			// Mark as done, read or not, so the throttler isn't left waiting
 			bar.Increment()
 			t.Done(nil)
 		}(asset, embeddedPlist)
 
 		t.Throttle()
 	}
-
+	if err == nil {
+		err = rows.Err()
+	}
+	// Let running parses finish, they query the database too
+	parsing.Wait()
 	bar.Finish()
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
 	log.Info().Msg(fmt.Sprintf("(%f seconds) Parsed %d total assets from album %s.", time.Since(start).Seconds(), newAssetCount, albumGUID))
 
-	return assetMap, mostRecentAsset
+	return assetMap, mostRecentAsset, nil
+}
+
+// readAsset finishes an asset read from its row. old is its previous state, possibly nil, and takes the place
+// of whatever can't be read, copied since it's still being served. Without it, an asset whose plist can't be
+// parsed is kept with what its row holds, and one whose comments can't be read fails the read.
+func readAsset(asset *Asset, embeddedPlist []byte, old *Asset, isRefresh bool, loc *time.Location) (*Asset, error) {
+	if err := parsePlist(asset, embeddedPlist, loc); err != nil {
+		if old != nil {
+			log.Warn().Err(err).Str("asset", asset.GUID).Msg("Could not parse asset, keeping its previous state")
+			return old.clone(), nil
+		}
+		log.Error().Err(err).Str("asset", asset.GUID).Msg("Could not parse asset, keeping only its row")
+		asset.Date = asset.Date.UTC()
+		asset.Day = asset.Date.In(loc).Format(DayFormat)
+	}
+
+	if _, err := parseComments(asset, isRefresh); err != nil {
+		if old == nil {
+			return nil, fmt.Errorf("reading comments of asset %s: %w", asset.GUID, err)
+		}
+		log.Warn().Err(err).Str("asset", asset.GUID).Msg("Could not read comments, keeping the previous ones")
+		asset.Comments, asset.SortingDate = old.clone().Comments, old.SortingDate
+	}
+	return asset, nil
+}
+
+// clone copies an asset along with its comment map, so the copy can be changed without touching a served asset
+func (a *Asset) clone() *Asset {
+	c := *a
+	c.Comments = make(map[string]*comment.Comment, len(a.Comments))
+	for k, v := range a.Comments {
+		c.Comments[k] = v
+	}
+	return &c
+}
+
+// parsePlist fills in an asset from its embedded plist
+func parsePlist(asset *Asset, embeddedPlist []byte, loc *time.Location) error {
+	plistData, err := nskeyedarchiver.Unarchive(embeddedPlist)
+	if err != nil {
+		return fmt.Errorf("decoding plist: %w", err)
+	}
+	if len(plistData) == 0 {
+		return fmt.Errorf("empty plist")
+	}
+	plistMap, ok := plistData[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected plist root %T", plistData[0])
+	}
+	if err := mapstructure.Decode(plistMap, &asset); err != nil {
+		return fmt.Errorf("mapping plist: %w", err)
+	}
+
+	// Dates are kept in UTC, Day is bucketed in loc
+	asset.Date = asset.Date.UTC()
+	asset.Day = asset.Date.In(loc).Format(DayFormat)
+
+	// Parse metadata
+	asset.Filetype = strings.ToLower(filepath.Ext(asset.Filename))
+	asset.MIME = mime.TypeByExtension(asset.Filetype)
+	asset.IsVideo = asset.Filetype == ".mp4" || asset.Filetype == ".mov"
+
+	// Graduate plist asset to main height/width data
+	for _, a := range asset.PlistAssetData {
+		if a.Metadata.MSAssetMetadataAssetType == "derivative" {
+			asset.Height = a.Metadata.MSAssetMetadataPixelHeight
+			asset.Width = a.Metadata.MSAssetMetadataPixelWidth
+			break
+		}
+	}
+
+	// Size is that of the largest stored file, which is the original when present
+	asset.Variants = make([]Variant, 0, len(asset.PlistAssetData))
+	for _, a := range asset.PlistAssetData {
+		if a.Metadata.MSAssetMetadataFileSize > asset.Size {
+			asset.Size = a.Metadata.MSAssetMetadataFileSize
+		}
+		asset.Variants = append(asset.Variants, Variant{
+			GUID:              a.GUID,
+			Type:              a.Metadata.MSAssetMetadataAssetType,
+			Width:             a.Metadata.MSAssetMetadataPixelWidth,
+			Height:            a.Metadata.MSAssetMetadataPixelHeight,
+			Size:              a.Metadata.MSAssetMetadataFileSize,
+			Hash:              hex.EncodeToString(a.FileHash),
+			AvailableOnServer: a.AssetDataAvailableOnServer,
+		})
+	}
+	return nil
 }
@@ -26,55 +26,72 @@ type Comment struct {
 	Content     string    `json:"Content"`
 }
 
-var determinedName string
+// In returns a copy of the comment with its date converted to loc
+func (c Comment) In(loc *time.Location) Comment {
+	c.Date = c.Date.In(loc)
+	return c
+}
 
-func parseCommentRows(rows *sql.Rows) map[string]*Comment {
+// parseCommentRows reads every comment row, failing on any it can't read
+func parseCommentRows(rows *sql.Rows) (map[string]*Comment, error) {
 	out := make(map[string]*Comment, 0)
 	var (
-		tempTime      float64
+		tempTime      sql.NullFloat64
 		embeddedPlist []byte
 		err           error
 	)
 
-	for rows != nil && rows.Next() {
+	for rows.Next() {
 		c := Comment{}
 
-		rows.Scan(&c.AssetGUID, &c.GUID, &tempTime, &c.IsCaption, &c.IsMine, &embeddedPlist)
+		var isCaption, isMine sql.NullBool
+		if err := rows.Scan(&c.AssetGUID, &c.GUID, &tempTime, &isCaption, &isMine, &embeddedPlist); err != nil {
+			return nil, fmt.Errorf("reading comment row: %w", err)
+		}
+		c.IsCaption, c.IsMine = isCaption.Bool, isMine.Bool
 
-		if c.Date, err = nskeyedarchiver.NSDateToTime(tempTime); err != nil {
-			log.Error().Msg(err.Error())
-			continue
+		// Comments are keyed by their date, one without can't be placed
+		if !tempTime.Valid {
+			return nil, fmt.Errorf("comment %s has no timestamp", c.GUID)
+		}
+		if c.Date, err = nskeyedarchiver.NSDateToTime(tempTime.Float64); err != nil {
+			return nil, fmt.Errorf("comment %s: %w", c.GUID, err)
 		}
 
 		plistData, err := nskeyedarchiver.Unarchive(embeddedPlist)
 		if err != nil {
-			fmt.Println("Error decoding plist:", err)
-			continue
+			return nil, fmt.Errorf("comment %s: decoding plist: %w", c.GUID, err)
 		}
-		plistMap := plistData[0].(map[string]interface{})
-		err = mapstructure.Decode(plistMap, &c)
-		if err != nil {
-			fmt.Println("Error mapping plist:", err)
-			continue
+		if len(plistData) == 0 {
+			return nil, fmt.Errorf("comment %s: empty plist", c.GUID)
 		}
-
-		// Set the user's name based on the IsMine bool
-		if determinedName == "" && c.IsMine && c.AuthorName != "" {
-			determinedName = c.AuthorName
+		plistMap, ok := plistData[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("comment %s: unexpected plist root %T", c.GUID, plistData[0])
 		}
+		if err := mapstructure.Decode(plistMap, &c); err != nil {
+			return nil, fmt.Errorf("comment %s: mapping plist: %w", c.GUID, err)
+		}
+
+		// Dates are kept in UTC
+		c.Date = c.Date.UTC()
 
 		// Append to output list
 		out[c.Date.Format(time.RFC3339Nano)] = &c
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading comments: %w", err)
+	}
 
-	return out
+	return out, nil
 }
 
-func GetComments(assetGUID string, oldComments *map[string]*Comment) map[string]*Comment {
+// GetComments returns the comments of an asset, leaving out oldComments when given
+func GetComments(assetGUID string, oldComments *map[string]*Comment) (map[string]*Comment, error) {
 	var excludeSlice strings.Builder
 	if oldComments != nil && len(*oldComments) > 0 {
 		log.Info().Msgf("Searching for refreshed comments, excluding %d existing ones", len(*oldComments))
-		excludeSlice.WriteString(" AND Comments.GUID NOT IN (")
+		excludeSlice.WriteString(" AND " + database.Schema.CommentGUID + " NOT IN (")
 		isFirstComment := true
 		for _, comment := range *oldComments {
 			if !isFirstComment {
@@ -86,14 +103,34 @@ func GetComments(assetGUID string, oldComments *map[string]*Comment) map[string]
 		excludeSlice.WriteString(")")
 	}
 
-	sql := fmt.Sprintf("SELECT AssetCollections.GUID, Comments.GUID, Comments.timestamp, Comments.isCaption, Comments.isMine, Comments.obj FROM Comments LEFT OUTER JOIN AssetCollections on AssetCollections.GUID = Comments.assetCollectionGUID WHERE AssetCollections.GUID = '%s'%s ORDER BY timestamp DESC", assetGUID, excludeSlice.String())
+	sql := fmt.Sprintf(database.Schema.Comments, excludeSlice.String())
 	//log.Info().Msg(sql)
-	rows, err := database.Query(sql)
+	rows, err := database.Query(sql, assetGUID)
 	if err != nil {
-		log.Error().Msg(err.Error())
-		return nil
+		return nil, err
 	}
 	defer rows.Close()
 
 	return parseCommentRows(rows)
 }
+
+// GetPlist returns the decoded plist a comment was parsed from
+func GetPlist(guid string) ([]interface{}, error) {
+	rows, err := database.Query(database.Schema.CommentPlist, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	var embeddedPlist []byte
+	if err := rows.Scan(&embeddedPlist); err != nil {
+		return nil, err
+	}
+	return nskeyedarchiver.Unarchive(embeddedPlist)
+}
@@ -0,0 +1,216 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/comment"
+	"github.com/qcasey/airphoto-server/pkg/media"
+	"github.com/qcasey/airphoto-server/pkg/xmp"
+	"github.com/rs/zerolog/log"
+)
+
+// fileDateFormat prefixes exported file names so they sort chronologically
+const fileDateFormat = "2006-01-02 15.04.05"
+
+// Filter selects which assets are exported. Zero values match everything.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	Author string
+}
+
+// Match reports whether the asset passes the filter
+func (f Filter) Match(a *asset.Asset) bool {
+	if !f.From.IsZero() && a.Date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !a.Date.Before(f.To) {
+		return false
+	}
+	if f.Author != "" && !strings.EqualFold(a.Author, f.Author) && a.AuthorID != f.Author {
+		return false
+	}
+	return true
+}
+
+// FileName names an asset by its date and author, keeping the original extension
+func FileName(a *asset.Asset, loc *time.Location) string {
+	author := a.Author
+	if author == "" {
+		author = "Unknown"
+	}
+	name := fmt.Sprintf("%s - %s - %s", a.Date.In(loc).Format(fileDateFormat), author, filepath.Base(a.Filename))
+	return Sanitize(name)
+}
+
+// Sanitize strips characters that are unsafe in file names on common filesystems
+func Sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 32 {
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// ManifestEntry describes one exported asset and everything said about it
+type ManifestEntry struct {
+	File      string             `json:"File"`
+	AssetGUID string             `json:"AssetGUID"`
+	Author    string             `json:"Author"`
+	Date      time.Time          `json:"Date"`
+	Comments  []*comment.Comment `json:"Comments"`
+}
+
+// NewManifestEntry returns the entry for an asset exported as file, with comments oldest first
+func NewManifestEntry(a *asset.Asset, file string) ManifestEntry {
+	entry := ManifestEntry{
+		File:      file,
+		AssetGUID: a.GUID,
+		Author:    a.Author,
+		Date:      a.Date,
+		Comments:  make([]*comment.Comment, 0, len(a.Comments)),
+	}
+	for _, c := range a.Comments {
+		entry.Comments = append(entry.Comments, c)
+	}
+	sort.Slice(entry.Comments, func(i, j int) bool {
+		return entry.Comments[i].Date.Before(entry.Comments[j].Date)
+	})
+	return entry
+}
+
+// WriteZip streams the originals of assets into a ZIP archive, followed by comments.json and captions.csv.
+// Assets without a local file are still listed in the manifest, with an empty File.
+func WriteZip(w io.Writer, albumName string, assets []*asset.Asset, mediaDir string, loc *time.Location, opts xmp.Options) error {
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Date.Before(assets[j].Date)
+	})
+
+	z := zip.NewWriter(w)
+	manifest := make([]ManifestEntry, 0, len(assets))
+	used := make(map[string]int)
+
+	for _, a := range assets {
+		name := ""
+		if path, err := media.FindOriginal(mediaDir, a); err != nil {
+			log.Warn().Err(err).Str("asset", a.GUID).Msg("Skipping asset without a local file")
+		} else {
+			name = unique(FileName(a, loc), used)
+			packet := xmp.Build(a, albumName)
+			var embedded []byte
+			if opts.Embed && xmp.CanEmbed(name, packet) {
+				embedded = packet
+			}
+			if err := addFile(z, name, path, a.Date, embedded); err != nil {
+				return err
+			}
+			if opts.Sidecar {
+				f, err := z.Create(xmp.SidecarName(name))
+				if err != nil {
+					return err
+				}
+				if _, err := f.Write(packet); err != nil {
+					return err
+				}
+			}
+		}
+		manifest = append(manifest, NewManifestEntry(a, name))
+	}
+
+	f, err := z.Create("comments.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	f, err = z.Create("captions.csv")
+	if err != nil {
+		return err
+	}
+	if err := WriteCaptions(f, manifest); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
+
+// WriteCaptions writes one CSV row per caption in the manifest
+func WriteCaptions(w io.Writer, manifest []ManifestEntry) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"File", "AssetGUID", "Author", "Date", "Caption"})
+	for _, entry := range manifest {
+		for _, cm := range entry.Comments {
+			if !cm.IsCaption {
+				continue
+			}
+			c.Write([]string{entry.File, entry.AssetGUID, cm.AuthorName, cm.Date.Format(time.RFC3339), cm.Content})
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// unique appends a counter to names that were already used in the archive
+func unique(name string, used map[string]int) string {
+	used[name]++
+	if used[name] == 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), used[name], ext)
+}
+
+// CopyMedia copies a media file, embedding packet as XMP when it isn't nil.
+// Files that can't take the packet, such as a .jpg that isn't really a JPEG, are copied unmodified.
+func CopyMedia(dst io.Writer, src io.ReadSeeker, packet []byte) error {
+	if packet != nil {
+		err := xmp.EmbedJPEG(dst, src, packet)
+		if !errors.Is(err, xmp.ErrNotJPEG) && !errors.Is(err, xmp.ErrPacketTooLarge) {
+			return err
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// addFile copies path into the archive without recompressing, media is already compressed
+func addFile(z *zip.Writer, name string, path string, modified time.Time, packet []byte) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := z.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+	return CopyMedia(dst, src, packet)
+}
@@ -0,0 +1,134 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/activity"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/media"
+)
+
+// MaxEntries is how many of the most recent events a feed lists
+const MaxEntries = 50
+
+// ContentType is the media type of Atom documents
+const ContentType = "application/atom+xml; charset=utf-8"
+
+// Feed is an Atom feed document
+type Feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Links   []Link   `xml:"link"`
+	Entries []Entry  `xml:"entry"`
+}
+
+// Link is an Atom link
+type Link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// Person is an Atom author
+type Person struct {
+	Name string `xml:"name"`
+}
+
+// Text is Atom text content with its type
+type Text struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Entry is a single post, comment, caption or like
+type Entry struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+	Author    Person `xml:"author"`
+	Links     []Link `xml:"link"`
+	Content   Text   `xml:"content"`
+}
+
+// Build turns activity events into a feed. baseURL is prepended to links so feed readers can follow them,
+// and a non-empty token is added to them for readers that can't send headers.
+// Links to media files are only included when withMedia is set, as the token must be allowed to fetch them.
+func Build(id string, title string, selfURL string, baseURL string, token string, withMedia bool, events activity.List) Feed {
+	if len(events) > MaxEntries {
+		events = events[:MaxEntries]
+	}
+
+	f := Feed{
+		ID:      id,
+		Title:   title,
+		Links:   []Link{{Href: selfURL, Rel: "self", Type: "application/atom+xml"}},
+		Entries: make([]Entry, 0, len(events)),
+	}
+
+	updated := time.Time{}
+	for _, e := range events {
+		if e.Date.After(updated) {
+			updated = e.Date
+		}
+		f.Entries = append(f.Entries, newEntry(e, baseURL, token, withMedia))
+	}
+	f.Updated = updated.UTC().Format(time.RFC3339)
+
+	return f
+}
+
+func newEntry(e activity.Event, baseURL string, token string, withMedia bool) Entry {
+	original := baseURL + media.FileURL(e.AlbumGUID, e.AssetGUID, "")
+	thumbnail := baseURL + media.FileURL(e.AlbumGUID, e.AssetGUID, asset.VariantDerivative)
+	if token != "" {
+		original += "?token=" + url.QueryEscape(token)
+		thumbnail += "&token=" + url.QueryEscape(token)
+	}
+	author := e.Author
+	if author == "" {
+		author = "Someone"
+	}
+
+	kind := "photo"
+	if e.IsVideo {
+		kind = "video"
+	}
+
+	var title, body string
+	switch e.Type {
+	case activity.TypeAsset:
+		title = fmt.Sprintf("%s posted a %s in %s", author, kind, e.AlbumName)
+	case activity.TypeCaption:
+		title = fmt.Sprintf("%s captioned a %s in %s", author, kind, e.AlbumName)
+		body = fmt.Sprintf("<p>%s</p>", html.EscapeString(e.Content))
+	case activity.TypeLike:
+		title = fmt.Sprintf("%s liked a %s in %s", author, kind, e.AlbumName)
+	default:
+		title = fmt.Sprintf("%s commented on a %s in %s", author, kind, e.AlbumName)
+		body = fmt.Sprintf("<p>%s</p>", html.EscapeString(e.Content))
+	}
+	var links []Link
+	if withMedia {
+		body = fmt.Sprintf(`<p><a href="%s"><img src="%s" alt="%s"/></a></p>%s`,
+			html.EscapeString(original), html.EscapeString(thumbnail), html.EscapeString(e.Filename), body)
+		links = []Link{{Href: original, Rel: "alternate"}, {Href: thumbnail, Rel: "enclosure"}}
+	}
+
+	date := e.Date.UTC().Format(time.RFC3339)
+	return Entry{
+		ID:        fmt.Sprintf("urn:airphoto:%s:%s", e.Type, e.GUID),
+		Title:     title,
+		Updated:   date,
+		Published: date,
+		Author:    Person{Name: author},
+		Links:     links,
+		Content:   Text{Type: "html", Body: body},
+	}
+}
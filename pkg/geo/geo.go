@@ -0,0 +1,139 @@
+package geo
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/media"
+)
+
+// MaxZoom is the deepest zoom level clustering accepts, matching common web map tiles
+const MaxZoom = 22
+
+// clusterCellSize is the clustering grid in pixels on a 256px tile
+const clusterCellSize = 64
+
+// FeatureCollection is a GeoJSON FeatureCollection
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON point feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a GeoJSON Point, coordinates are longitude then latitude
+type Geometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// ThumbnailURL links to the derivative of an asset, as served by the file endpoint
+func ThumbnailURL(a *asset.Asset) string {
+	return media.FileURL(a.AlbumGUID, a.GUID, asset.VariantDerivative)
+}
+
+func point(lat float64, lon float64) Geometry {
+	return Geometry{Type: "Point", Coordinates: []float64{lon, lat}}
+}
+
+// Collect returns a feature per geotagged asset, newest first, with dates in loc
+func Collect(assets []*asset.Asset, loc *time.Location) FeatureCollection {
+	located := geotagged(assets)
+	fc := FeatureCollection{Type: "FeatureCollection", Features: make([]Feature, 0, len(located))}
+	for _, a := range located {
+		l := a.Metadata.Location
+		fc.Features = append(fc.Features, Feature{
+			Type:     "Feature",
+			Geometry: point(l.Latitude, l.Longitude),
+			Properties: map[string]interface{}{
+				"GUID":      a.GUID,
+				"AlbumGUID": a.AlbumGUID,
+				"Date":      a.Date.In(loc),
+				"Author":    a.Author,
+				"IsVideo":   a.IsVideo,
+				"Thumbnail": ThumbnailURL(a),
+			},
+		})
+	}
+	return fc
+}
+
+// Cluster groups geotagged assets that would overlap on a map at the given zoom level.
+// Single assets are emitted like Collect does, groups as a point at their mean position.
+func Cluster(assets []*asset.Asset, zoom int, loc *time.Location) FeatureCollection {
+	type cell struct{ x, y int }
+	cells := make(map[cell][]*asset.Asset)
+	order := make([]cell, 0)
+	for _, a := range geotagged(assets) {
+		x, y := pixel(a.Metadata.Location.Latitude, a.Metadata.Location.Longitude, zoom)
+		c := cell{int(x / clusterCellSize), int(y / clusterCellSize)}
+		if _, ok := cells[c]; !ok {
+			order = append(order, c)
+		}
+		cells[c] = append(cells[c], a)
+	}
+
+	fc := FeatureCollection{Type: "FeatureCollection", Features: make([]Feature, 0, len(cells))}
+	for _, c := range order {
+		members := cells[c]
+		if len(members) == 1 {
+			fc.Features = append(fc.Features, Collect(members, loc).Features...)
+			continue
+		}
+
+		var lat, lon float64
+		guids := make([]string, 0, len(members))
+		for _, a := range members {
+			lat += a.Metadata.Location.Latitude
+			lon += a.Metadata.Location.Longitude
+			guids = append(guids, a.GUID)
+		}
+		n := float64(len(members))
+
+		// members are newest first, so the first one represents the cluster
+		fc.Features = append(fc.Features, Feature{
+			Type:     "Feature",
+			Geometry: point(lat/n, lon/n),
+			Properties: map[string]interface{}{
+				"Cluster":   true,
+				"Count":     len(members),
+				"GUIDs":     guids,
+				"Date":      members[0].Date.In(loc),
+				"Thumbnail": ThumbnailURL(members[0]),
+			},
+		})
+	}
+	return fc
+}
+
+// geotagged filters assets down to those with a location, newest first
+func geotagged(assets []*asset.Asset) []*asset.Asset {
+	out := make([]*asset.Asset, 0)
+	for _, a := range assets {
+		if a.HasLocation() {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Date.After(out[j].Date)
+	})
+	return out
+}
+
+// pixel projects a coordinate to Web Mercator pixels at the given zoom level
+func pixel(lat float64, lon float64, zoom int) (float64, float64) {
+	// Mercator is undefined at the poles
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	scale := 256 * math.Exp2(float64(zoom))
+	rad := lat * math.Pi / 180
+	x := (lon + 180) / 360 * scale
+	y := (1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * scale
+	return x, y
+}
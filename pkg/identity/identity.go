@@ -0,0 +1,111 @@
+package identity
+
+import (
+	"github.com/qcasey/airphoto-server/pkg/album"
+)
+
+// Sources an identity can come from
+const (
+	SourceNone     = ""
+	SourceConfig   = "config"
+	SourceDetected = "detected"
+)
+
+// Identity describes the owner of the iCloud account the database belongs to
+type Identity struct {
+	Name     string `json:"Name"`
+	AuthorID string `json:"AuthorID"`
+	Source   string `json:"Source"`
+
+	// Number of assets and comments flagged IsMine that agreed with this identity
+	AssetCount   int `json:"AssetCount"`
+	CommentCount int `json:"CommentCount"`
+}
+
+// Known reports whether any identity has been configured or detected
+func (i Identity) Known() bool {
+	return i.AuthorID != "" || i.Name != ""
+}
+
+// Matches reports whether the given author belongs to this identity.
+// AuthorID is preferred, the display name is only used when either side lacks an ID.
+func (i Identity) Matches(authorID string, name string) bool {
+	if i.AuthorID != "" && authorID != "" {
+		return i.AuthorID == authorID
+	}
+	return i.Name != "" && i.Name == name
+}
+
+type candidate struct {
+	name     string
+	assets   int
+	comments int
+}
+
+// Detect derives the owner from the IsMine flags of every asset and comment.
+// The AuthorID seen most often on IsMine content wins; the first non-empty name seen for it is used.
+func Detect(albums []*album.Album) Identity {
+	candidates := make(map[string]*candidate)
+	get := func(authorID string) *candidate {
+		c, ok := candidates[authorID]
+		if !ok {
+			c = &candidate{}
+			candidates[authorID] = c
+		}
+		return c
+	}
+
+	for _, al := range albums {
+		for _, as := range al.Assets {
+			if as.IsMine {
+				c := get(as.AuthorID)
+				c.assets++
+				if c.name == "" {
+					c.name = as.Author
+				}
+			}
+			for _, cm := range as.Comments {
+				if cm.IsMine {
+					c := get(cm.AuthorID)
+					c.comments++
+					if c.name == "" {
+						c.name = cm.AuthorName
+					}
+				}
+			}
+		}
+	}
+
+	var (
+		best  Identity
+		found bool
+	)
+	for authorID, c := range candidates {
+		if found && !betterCandidate(authorID, c, best) {
+			continue
+		}
+		best = Identity{
+			Name:         c.name,
+			AuthorID:     authorID,
+			Source:       SourceDetected,
+			AssetCount:   c.assets,
+			CommentCount: c.comments,
+		}
+		found = true
+	}
+
+	return best
+}
+
+// betterCandidate reports whether c should replace the current best identity.
+// Content without an AuthorID only wins if nothing else is available; ties break on AuthorID so results are stable.
+func betterCandidate(authorID string, c *candidate, best Identity) bool {
+	if (authorID == "") != (best.AuthorID == "") {
+		return authorID != ""
+	}
+	total, bestTotal := c.assets+c.comments, best.AssetCount+best.CommentCount
+	if total != bestTotal {
+		return total > bestTotal
+	}
+	return authorID < best.AuthorID
+}
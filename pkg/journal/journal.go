@@ -0,0 +1,287 @@
+package journal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+)
+
+// Types of content a change can be about
+const (
+	TypeAlbum   = "album"
+	TypeAsset   = "asset"
+	TypeComment = "comment"
+)
+
+// MaxChanges is how many changes are kept. Clients with an older cursor must sync from scratch.
+const MaxChanges = 20000
+
+var (
+	// ErrInvalidCursor is returned for cursors this journal didn't hand out
+	ErrInvalidCursor = errors.New("invalid sync cursor")
+	// ErrExpired is returned for cursors older than the oldest kept change
+	ErrExpired = errors.New("sync cursor has expired")
+)
+
+// Change records that an album, asset or comment was added, changed or deleted
+type Change struct {
+	Seq       uint64    `json:"Seq"`
+	Type      string    `json:"Type"`
+	GUID      string    `json:"GUID"`
+	AlbumGUID string    `json:"AlbumGUID,omitempty"`
+	AssetGUID string    `json:"AssetGUID,omitempty"`
+	Deleted   bool      `json:"Deleted,omitempty"`
+	Date      time.Time `json:"Date"`
+}
+
+// entity is the last seen state of an album, asset or comment
+type entity struct {
+	Type      string `json:"Type"`
+	GUID      string `json:"GUID"`
+	AlbumGUID string `json:"AlbumGUID,omitempty"`
+	AssetGUID string `json:"AssetGUID,omitempty"`
+	Hash      string `json:"Hash"`
+}
+
+func (e entity) key() string {
+	return e.Type + "/" + e.AlbumGUID + "/" + e.AssetGUID + "/" + e.GUID
+}
+
+// Journal persists the changes found between refreshes to a JSON file
+type Journal struct {
+	path string
+	// epoch identifies this journal, so cursors from a deleted journal are rejected
+	epoch string
+	seq   uint64
+	// trimmed is the newest change dropped to stay under MaxChanges
+	trimmed  uint64
+	changes  []Change
+	entities map[string]entity
+	// baselined is false until the first refresh has been recorded
+	baselined bool
+	mutex     sync.RWMutex
+}
+
+type journalFile struct {
+	Epoch     string            `json:"Epoch"`
+	Seq       uint64            `json:"Seq"`
+	Trimmed   uint64            `json:"Trimmed"`
+	Baselined bool              `json:"Baselined"`
+	Changes   []Change          `json:"Changes"`
+	Entities  map[string]entity `json:"Entities"`
+}
+
+// Open loads the journal at path, creating it if it doesn't exist
+func Open(path string) (*Journal, error) {
+	j := &Journal{path: path, entities: make(map[string]entity)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var f journalFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("corrupt journal: %w", err)
+		}
+		j.epoch, j.seq, j.trimmed, j.baselined, j.changes = f.Epoch, f.Seq, f.Trimmed, f.Baselined, f.Changes
+		if f.Entities != nil {
+			j.entities = f.Entities
+		}
+	}
+
+	if j.epoch == "" {
+		j.epoch = randomHex(4)
+	}
+	return j, j.save()
+}
+
+// Record diffs the albums against the previous refresh and appends what changed.
+// The first refresh only takes a baseline, clients start from a full sync anyway.
+func (j *Journal) Record(albums []*album.Album) ([]Change, error) {
+	current := snapshot(albums)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if !j.baselined {
+		j.entities, j.baselined = current, true
+		return nil, j.save()
+	}
+
+	now := time.Now().UTC()
+	var changes []Change
+	for key, e := range current {
+		if previous, ok := j.entities[key]; !ok || previous.Hash != e.Hash {
+			changes = append(changes, newChange(e, false, now))
+		}
+	}
+	for key, e := range j.entities {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, newChange(e, true, now))
+		}
+	}
+	j.entities = current
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	// Parents before children, so clients can apply changes in order
+	sort.SliceStable(changes, func(a, b int) bool {
+		return typeOrder(changes[a].Type) < typeOrder(changes[b].Type)
+	})
+	for i := range changes {
+		j.seq++
+		changes[i].Seq = j.seq
+	}
+	j.changes = append(j.changes, changes...)
+	if over := len(j.changes) - MaxChanges; over > 0 {
+		j.trimmed = j.changes[over-1].Seq
+		j.changes = append([]Change(nil), j.changes[over:]...)
+	}
+	return changes, j.save()
+}
+
+// Cursor points after the newest change
+func (j *Journal) Cursor() string {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+	return j.cursor()
+}
+
+func (j *Journal) cursor() string {
+	return j.epoch + "." + strconv.FormatUint(j.seq, 10)
+}
+
+// Since returns the changes after cursor, only the newest per album, asset or comment, and the cursor to resume from
+func (j *Journal) Since(cursor string) ([]Change, string, error) {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	epoch, seqText := cursor, ""
+	if i := strings.LastIndex(cursor, "."); i >= 0 {
+		epoch, seqText = cursor[:i], cursor[i+1:]
+	}
+	since, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil || epoch != j.epoch || since > j.seq {
+		return nil, "", ErrInvalidCursor
+	}
+	if since < j.trimmed {
+		return nil, "", ErrExpired
+	}
+
+	latest := make(map[string]int)
+	var out []Change
+	for _, c := range j.changes {
+		if c.Seq <= since {
+			continue
+		}
+		key := entity{Type: c.Type, GUID: c.GUID, AlbumGUID: c.AlbumGUID, AssetGUID: c.AssetGUID}.key()
+		if i, ok := latest[key]; ok {
+			out[i] = c
+			continue
+		}
+		latest[key] = len(out)
+		out = append(out, c)
+	}
+	sort.SliceStable(out, func(a, b int) bool {
+		return out[a].Seq < out[b].Seq
+	})
+	return out, j.cursor(), nil
+}
+
+// snapshot fingerprints every album, asset and comment
+func snapshot(albums []*album.Album) map[string]entity {
+	out := make(map[string]entity)
+	add := func(e entity, v interface{}) {
+		e.Hash = hash(v)
+		out[e.key()] = e
+	}
+
+	for _, a := range albums {
+		withoutAssets := *a
+		withoutAssets.Assets = nil
+		add(entity{Type: TypeAlbum, GUID: a.GUID}, withoutAssets)
+
+		for _, as := range a.Assets {
+			withoutComments := *as
+			withoutComments.Comments = nil
+			add(entity{Type: TypeAsset, GUID: as.GUID, AlbumGUID: a.GUID}, withoutComments)
+
+			for _, c := range as.Comments {
+				add(entity{Type: TypeComment, GUID: c.GUID, AlbumGUID: a.GUID, AssetGUID: as.GUID}, c)
+			}
+		}
+	}
+	return out
+}
+
+func hash(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// Every field of the models is encodable
+		panic(err)
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func newChange(e entity, deleted bool, date time.Time) Change {
+	return Change{Type: e.Type, GUID: e.GUID, AlbumGUID: e.AlbumGUID, AssetGUID: e.AssetGUID, Deleted: deleted, Date: date}
+}
+
+func typeOrder(t string) int {
+	switch t {
+	case TypeAlbum:
+		return 0
+	case TypeAsset:
+		return 1
+	}
+	return 2
+}
+
+// save writes the journal atomically. The caller must hold the lock, or be the only user.
+func (j *Journal) save() error {
+	f := journalFile{
+		Epoch:     j.epoch,
+		Seq:       j.seq,
+		Trimmed:   j.trimmed,
+		Baselined: j.baselined,
+		Changes:   j.changes,
+		Entities:  j.entities,
+	}
+	if f.Changes == nil {
+		f.Changes = []Change{}
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
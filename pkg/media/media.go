@@ -0,0 +1,96 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/qcasey/airphoto-server/pkg/asset"
+)
+
+// ErrNotFound is returned when no local file exists for an asset
+var ErrNotFound = errors.New("media file not found")
+
+// Find returns the local path of an asset's file, or of one of its variants when v is not nil.
+// MediaStream stores files under <root>/<album GUID>/<GUID>/, keyed by the variant GUID or the asset GUID.
+// A requested variant is only looked for in its own directory, so a missing one is never served as another file.
+func Find(root string, a *asset.Asset, v *asset.Variant) (string, error) {
+	dir := filepath.Join(root, a.AlbumGUID, a.GUID)
+	if v != nil {
+		if v.GUID == "" {
+			return "", ErrNotFound
+		}
+		dir = filepath.Join(root, a.AlbumGUID, v.GUID)
+	}
+
+	// Prefer the asset's own filename, otherwise take the file if it's the only one stored
+	if a.Filename != "" {
+		path := filepath.Join(dir, filepath.Base(a.Filename))
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", ErrNotFound
+	}
+	var found string
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if found != "" {
+			return "", ErrNotFound
+		}
+		found = filepath.Join(dir, e.Name())
+	}
+	if found == "" {
+		return "", ErrNotFound
+	}
+	return found, nil
+}
+
+// FindOriginal returns the best local file for an asset, preferring its original variant over the asset's own directory
+func FindOriginal(root string, a *asset.Asset) (string, error) {
+	if v, ok := a.Variant(""); ok {
+		if path, err := Find(root, a, &v); err == nil {
+			return path, nil
+		}
+	}
+	return Find(root, a, nil)
+}
+
+// FileURL is the API path serving an asset's file, optionally a specific variant
+func FileURL(albumGUID string, assetGUID string, variant string) string {
+	u := fmt.Sprintf("/albums/%s/assets/%s/file", url.PathEscape(albumGUID), url.PathEscape(assetGUID))
+	if variant != "" {
+		u += "?variant=" + url.QueryEscape(variant)
+	}
+	return u
+}
+
+// Serve writes the file of an asset's variant, selected by type or GUID, defaulting to the original
+func Serve(w http.ResponseWriter, r *http.Request, root string, a *asset.Asset, variantKey string) {
+	path, err := FindOriginal(root, a)
+	if variantKey != "" {
+		v, ok := a.Variant(variantKey)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if v.Type != asset.VariantOriginal {
+			path, err = Find(root, a, &v)
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Variants may differ in format from the original, so let the file's extension decide the type
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,223 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// exifSearchLimit is how far into a file we look for an EXIF block.
+// JPEG keeps it in the first segments, HEIC near the start of the file.
+const exifSearchLimit = 256 * 1024
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// EXIF tags we read
+const (
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+	tagGPSAltitudeRef     = 0x0005
+	tagGPSAltitude        = 0x0006
+)
+
+const exifDateFormat = "2006:01:02 15:04:05"
+
+// typeSizes is the byte size of each TIFF field type
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func readExif(r io.Reader, loc *time.Location) (*Metadata, error) {
+	buf := make([]byte, exifSearchLimit)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	start := bytes.Index(buf, exifHeader)
+	if start < 0 {
+		return nil, ErrNoMetadata
+	}
+	t, ok := newTiff(buf[start+len(exifHeader):])
+	if !ok {
+		return nil, ErrNoMetadata
+	}
+
+	m := &Metadata{}
+	ifd0 := t.ifd(t.order.Uint32(t.data[4:8]))
+	m.CameraMake = t.string(ifd0[tagMake])
+	m.CameraModel = t.string(ifd0[tagModel])
+	m.Orientation = int(t.uint(ifd0[tagOrientation]))
+
+	dateTime, offset := t.string(ifd0[tagDateTime]), ""
+	if e, ok := ifd0[tagExifIFD]; ok {
+		exif := t.ifd(t.uint(e))
+		if original := t.string(exif[tagDateTimeOriginal]); original != "" {
+			dateTime = original
+			offset = t.string(exif[tagOffsetTimeOriginal])
+		}
+	}
+	if captured, ok := parseExifDate(dateTime, offset, loc); ok {
+		m.CaptureDate = &captured
+	}
+
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		m.Location = t.location(t.ifd(t.uint(e)))
+	}
+
+	return m, nil
+}
+
+func newTiff(data []byte) (*tiff, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, false
+	}
+	if t.order.Uint16(data[2:4]) != 42 {
+		return nil, false
+	}
+	return t, true
+}
+
+// ifd reads the directory at offset, skipping anything that points outside the data
+func (t *tiff) ifd(offset uint32) map[uint16]tiffEntry {
+	entries := make(map[uint16]tiffEntry)
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return entries
+	}
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	for i := uint32(0); i < count; i++ {
+		pos := uint64(offset) + 2 + uint64(i)*12
+		if pos+12 > uint64(len(t.data)) {
+			break
+		}
+		raw := t.data[pos : pos+12]
+		e := tiffEntry{
+			typ:   t.order.Uint16(raw[2:4]),
+			count: t.order.Uint32(raw[4:8]),
+		}
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		length := uint64(size) * uint64(e.count)
+		if length <= 4 {
+			e.value = raw[8 : 8+length]
+		} else {
+			valueOffset := uint64(t.order.Uint32(raw[8:12]))
+			if valueOffset+length > uint64(len(t.data)) {
+				continue
+			}
+			e.value = t.data[valueOffset : valueOffset+length]
+		}
+		entries[t.order.Uint16(raw[0:2])] = e
+	}
+	return entries
+}
+
+func (t *tiff) string(e tiffEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+func (t *tiff) uint(e tiffEntry) uint32 {
+	switch {
+	case e.typ == 1 && len(e.value) >= 1:
+		return uint32(e.value[0])
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value)
+	}
+	return 0
+}
+
+func (t *tiff) rationals(e tiffEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	out := make([]float64, 0, e.count)
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		num, den := t.order.Uint32(e.value[i:]), t.order.Uint32(e.value[i+4:])
+		if den == 0 {
+			out = append(out, 0)
+			continue
+		}
+		out = append(out, float64(num)/float64(den))
+	}
+	return out
+}
+
+// location converts GPS degrees/minutes/seconds into a signed coordinate
+func (t *tiff) location(gps map[uint16]tiffEntry) *Location {
+	lat, lon := t.rationals(gps[tagGPSLatitude]), t.rationals(gps[tagGPSLongitude])
+	if len(lat) < 3 || len(lon) < 3 {
+		return nil
+	}
+
+	l := &Location{
+		Latitude:  lat[0] + lat[1]/60 + lat[2]/3600,
+		Longitude: lon[0] + lon[1]/60 + lon[2]/3600,
+	}
+	if t.string(gps[tagGPSLatitudeRef]) == "S" {
+		l.Latitude = -l.Latitude
+	}
+	if t.string(gps[tagGPSLongitudeRef]) == "W" {
+		l.Longitude = -l.Longitude
+	}
+	if alt := t.rationals(gps[tagGPSAltitude]); len(alt) > 0 {
+		l.Altitude = alt[0]
+		if ref := gps[tagGPSAltitudeRef]; len(ref.value) > 0 && ref.value[0] == 1 {
+			l.Altitude = -l.Altitude
+		}
+	}
+	return l
+}
+
+func parseExifDate(value string, offset string, loc *time.Location) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if offset != "" {
+		if t, err := time.Parse(exifDateFormat+"-07:00", value+offset); err == nil {
+			return t.UTC(), true
+		}
+	}
+	t, err := time.ParseInLocation(exifDateFormat, value, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
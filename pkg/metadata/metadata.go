@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoMetadata is returned when a file holds nothing we know how to read
+var ErrNoMetadata = errors.New("no metadata found")
+
+// Metadata is what could be read from an asset's media file
+type Metadata struct {
+	CaptureDate *time.Time `json:"CaptureDate,omitempty"`
+	CameraMake  string     `json:"CameraMake,omitempty"`
+	CameraModel string     `json:"CameraModel,omitempty"`
+	Orientation int        `json:"Orientation,omitempty"`
+	Location    *Location  `json:"Location,omitempty"`
+
+	// Videos only
+	Duration float64 `json:"Duration,omitempty"` // in seconds
+	Codec    string  `json:"Codec,omitempty"`
+}
+
+// Location is a WGS84 coordinate, altitude is in meters
+type Location struct {
+	Latitude  float64 `json:"Latitude"`
+	Longitude float64 `json:"Longitude"`
+	Altitude  float64 `json:"Altitude,omitempty"`
+}
+
+// In returns a copy of the metadata with its capture date converted to loc
+func (m Metadata) In(loc *time.Location) Metadata {
+	if m.CaptureDate != nil {
+		captured := m.CaptureDate.In(loc)
+		m.CaptureDate = &captured
+	}
+	return m
+}
+
+// Extract reads metadata from the file at path.
+// Capture dates without an explicit offset are interpreted in loc.
+func Extract(path string, loc *time.Location) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mov", ".mp4", ".m4v":
+		return readVideo(f)
+	default:
+		return readExif(f, loc)
+	}
+}
+
+type cacheEntry struct {
+	modTime  time.Time
+	size     int64
+	metadata *Metadata
+	err      error
+}
+
+// Cache remembers extracted metadata until the underlying file changes
+type Cache struct {
+	Location *time.Location
+
+	entries map[string]cacheEntry
+	mutex   sync.Mutex
+}
+
+// NewCache returns an empty cache interpreting zoneless dates in loc
+func NewCache(loc *time.Location) *Cache {
+	return &Cache{
+		Location: loc,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+// Get returns the metadata for path, extracting it only if the file is new or modified
+func (c *Cache) Get(path string) (*Metadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	entry, ok := c.entries[path]
+	c.mutex.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.metadata, entry.err
+	}
+
+	m, err := Extract(path, c.Location)
+	c.mutex.Lock()
+	c.entries[path] = cacheEntry{modTime: info.ModTime(), size: info.Size(), metadata: m, err: err}
+	c.mutex.Unlock()
+	return m, err
+}
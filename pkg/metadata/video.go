@@ -0,0 +1,199 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// maxMoovSize bounds how much of a video's header we are willing to load
+const maxMoovSize = 64 * 1024 * 1024
+
+// QuickTime timestamps count seconds from 1904
+var quickTimeEpoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// iso6709 matches locations like "+37.7858-122.4064+012.345/"
+var iso6709 = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)?`)
+
+type atom struct {
+	kind string
+	data []byte
+}
+
+// readVideo walks the top level atoms of an MP4/QuickTime file to find and parse the moov atom
+func readVideo(r io.ReadSeeker) (*Metadata, error) {
+	// Atom sizes come from the file, so every skip is checked against its real length
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 16)
+	var pos int64
+	for {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if err == io.EOF {
+				return nil, ErrNoMetadata
+			}
+			return nil, err
+		}
+		size, headerSize := uint64(binary.BigEndian.Uint32(header[:4])), uint64(8)
+		kind := string(header[4:8])
+		if size == 1 {
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, err
+			}
+			size, headerSize = binary.BigEndian.Uint64(header[8:16]), 16
+		}
+		pos += int64(headerSize)
+		if size == 0 && kind != "moov" {
+			// Atom runs to the end of the file
+			return nil, ErrNoMetadata
+		}
+		if size != 0 && (size < headerSize || size > math.MaxInt64 || size-headerSize > uint64(end-pos)) {
+			return nil, errors.New("malformed atom")
+		}
+
+		if kind == "moov" {
+			var body []byte
+			if size == 0 {
+				body, err = ioutil.ReadAll(io.LimitReader(r, maxMoovSize))
+			} else {
+				if size-headerSize > maxMoovSize {
+					return nil, errors.New("moov atom too large")
+				}
+				body = make([]byte, size-headerSize)
+				_, err = io.ReadFull(r, body)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return parseMoov(body), nil
+		}
+
+		if pos, err = r.Seek(int64(size-headerSize), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// children splits an atom's body into its child atoms
+func children(data []byte) []atom {
+	var out []atom
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		headerSize := uint64(8)
+		if size == 1 && len(data) >= 16 {
+			size, headerSize = binary.BigEndian.Uint64(data[8:16]), 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			break
+		}
+		out = append(out, atom{kind: string(data[4:8]), data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return out
+}
+
+func find(atoms []atom, kind string) (atom, bool) {
+	for _, a := range atoms {
+		if a.kind == kind {
+			return a, true
+		}
+	}
+	return atom{}, false
+}
+
+// path descends through nested atoms, e.g. path(trak, "mdia", "hdlr")
+func path(data []byte, kinds ...string) (atom, bool) {
+	current := atom{data: data}
+	for _, kind := range kinds {
+		next, ok := find(children(current.data), kind)
+		if !ok {
+			return atom{}, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+func parseMoov(moov []byte) *Metadata {
+	m := &Metadata{}
+
+	if mvhd, ok := path(moov, "mvhd"); ok {
+		parseMvhd(mvhd.data, m)
+	}
+
+	// The codec comes from the first video track's sample description
+	for _, trak := range children(moov) {
+		if trak.kind != "trak" {
+			continue
+		}
+		hdlr, ok := path(trak.data, "mdia", "hdlr")
+		if !ok || len(hdlr.data) < 12 || string(hdlr.data[8:12]) != "vide" {
+			continue
+		}
+		if stsd, ok := path(trak.data, "mdia", "minf", "stbl", "stsd"); ok && len(stsd.data) >= 16 {
+			m.Codec = string(stsd.data[12:16])
+		}
+		break
+	}
+
+	// Apple stores the recording location as an ISO 6709 string
+	if xyz, ok := path(moov, "udta", "\xa9xyz"); ok && len(xyz.data) > 4 {
+		m.Location = parseISO6709(string(xyz.data[4:]))
+	}
+
+	return m
+}
+
+func parseMvhd(data []byte, m *Metadata) {
+	if len(data) < 1 {
+		return
+	}
+	var created, timescale, duration uint64
+	switch {
+	case data[0] == 1 && len(data) >= 32:
+		created = binary.BigEndian.Uint64(data[4:12])
+		timescale = uint64(binary.BigEndian.Uint32(data[20:24]))
+		duration = binary.BigEndian.Uint64(data[24:32])
+	case data[0] == 0 && len(data) >= 20:
+		created = uint64(binary.BigEndian.Uint32(data[4:8]))
+		timescale = uint64(binary.BigEndian.Uint32(data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	default:
+		return
+	}
+
+	if timescale > 0 {
+		m.Duration = float64(duration) / float64(timescale)
+	}
+	if created > 0 {
+		captured := quickTimeEpoch.Add(time.Duration(created) * time.Second)
+		m.CaptureDate = &captured
+	}
+}
+
+func parseISO6709(value string) *Location {
+	match := iso6709.FindStringSubmatch(value)
+	if match == nil {
+		return nil
+	}
+	l := &Location{}
+	l.Latitude, _ = strconv.ParseFloat(match[1], 64)
+	l.Longitude, _ = strconv.ParseFloat(match[2], 64)
+	if match[3] != "" {
+		l.Altitude, _ = strconv.ParseFloat(match[3], 64)
+	}
+	return l
+}
@@ -0,0 +1,308 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/export"
+	"github.com/qcasey/airphoto-server/pkg/media"
+	"github.com/qcasey/airphoto-server/pkg/xmp"
+	"github.com/rs/zerolog/log"
+)
+
+// indexFile records what has been mirrored, relative to the mirror's root
+const indexFile = ".mirrored.json"
+
+// Deleting more than maxDeleteShare of the mirror in one sync is refused, unless it's no more than minDeleteGuard assets
+const (
+	maxDeleteShare = 0.25
+	minDeleteGuard = 5
+)
+
+// Record is a mirrored asset. Paths are relative to the mirror's root.
+// Comments stamps the comments its sidecars were last written with, and is empty until they are.
+// Asset is the asset as of that write, so it's still known once removed, even across restarts.
+type Record struct {
+	GUID         string       `json:"GUID"`
+	AlbumGUID    string       `json:"AlbumGUID"`
+	Path         string       `json:"Path"`
+	Sidecar      string       `json:"Sidecar"`
+	XMPSidecar   string       `json:"XMPSidecar,omitempty"`
+	CommentCount int          `json:"CommentCount"`
+	Comments     string       `json:"Comments,omitempty"`
+	Asset        *asset.Asset `json:"Asset,omitempty"`
+	MirroredAt   time.Time    `json:"MirroredAt"`
+}
+
+// Mirror copies album media into a local directory tree, laid out as Album/YYYY/MM/file
+type Mirror struct {
+	Root     string
+	MediaDir string
+	Location *time.Location
+
+	// Delete removes mirrored files once their asset disappears from the database,
+	// unless so much disappears at once that the read is more likely wrong
+	Delete bool
+
+	// XMP controls writing captions and comments for photo managers to read
+	XMP xmp.Options
+
+	records map[string]Record
+	mutex   sync.RWMutex
+}
+
+// New opens the mirror at root, loading the record of previously mirrored assets
+func New(root string, mediaDir string, loc *time.Location, delete bool) (*Mirror, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	m := &Mirror{
+		Root:     root,
+		MediaDir: mediaDir,
+		Location: loc,
+		Delete:   delete,
+		records:  make(map[string]Record),
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, indexFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.records); err != nil {
+		return nil, fmt.Errorf("corrupt mirror index: %w", err)
+	}
+	return m, nil
+}
+
+// Mirrored returns the record of a mirrored asset
+func (m *Mirror) Mirrored(guid string) (Record, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	r, ok := m.records[guid]
+	return r, ok
+}
+
+// Sync copies media that hasn't been mirrored yet and refreshes sidecars whose comments changed
+func (m *Mirror) Sync(albums []*album.Album) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	present := make(map[string]bool)
+	copied, updated := 0, 0
+	for _, al := range albums {
+		for _, a := range al.Assets {
+			present[a.GUID] = true
+
+			stamp := commentsStamp(a)
+			record, ok := m.records[a.GUID]
+			if !ok {
+				var err error
+				if record, err = m.copyAsset(al, a); err != nil {
+					log.Warn().Err(err).Str("asset", a.GUID).Msg("Could not mirror asset")
+					continue
+				}
+				// Record the copy right away so a failed sidecar is retried without copying the media again
+				m.records[a.GUID] = record
+				copied++
+			} else if record.Comments == stamp {
+				continue
+			} else {
+				updated++
+			}
+
+			if err := m.writeSidecars(al, a, &record); err != nil {
+				log.Warn().Err(err).Str("asset", a.GUID).Msg("Could not write mirror sidecar")
+				continue
+			}
+			record.CommentCount = len(a.Comments)
+			record.Comments = stamp
+			record.Asset = a
+			m.records[a.GUID] = record
+		}
+	}
+
+	removed := 0
+	if m.Delete {
+		var stale []string
+		for guid := range m.records {
+			if !present[guid] {
+				stale = append(stale, guid)
+			}
+		}
+		if err := m.checkDelete(albums, stale); err != nil {
+			log.Warn().Err(err).Int("assets", len(stale)).Msg("Not deleting mirrored assets")
+			stale = nil
+		}
+		for _, guid := range stale {
+			record := m.records[guid]
+			os.Remove(filepath.Join(m.Root, record.Path))
+			os.Remove(filepath.Join(m.Root, record.Sidecar))
+			if record.XMPSidecar != "" {
+				os.Remove(filepath.Join(m.Root, record.XMPSidecar))
+			}
+			delete(m.records, guid)
+			removed++
+		}
+	}
+
+	if copied+updated+removed == 0 {
+		return nil
+	}
+	log.Info().Msgf("Mirrored %d new assets, updated %d sidecars, removed %d assets.", copied, updated, removed)
+	return m.saveIndex()
+}
+
+// checkDelete refuses deletions that look more like a misread database than removed assets:
+// a whole album disappearing, or more than maxDeleteShare of the mirror going at once
+func (m *Mirror) checkDelete(albums []*album.Album, stale []string) error {
+	known := make(map[string]bool, len(albums))
+	for _, al := range albums {
+		known[al.GUID] = true
+	}
+	for _, guid := range stale {
+		if albumGUID := m.records[guid].AlbumGUID; !known[albumGUID] {
+			return fmt.Errorf("album %s disappeared", albumGUID)
+		}
+	}
+	if len(stale) > minDeleteGuard && float64(len(stale)) > maxDeleteShare*float64(len(m.records)) {
+		return fmt.Errorf("%d of %d mirrored assets would be deleted", len(stale), len(m.records))
+	}
+	return nil
+}
+
+// copyAsset copies an asset's original into Album/YYYY/MM/, never overwriting an existing file
+func (m *Mirror) copyAsset(al *album.Album, a *asset.Asset) (Record, error) {
+	src, err := media.FindOriginal(m.MediaDir, a)
+	if err != nil {
+		return Record{}, err
+	}
+
+	local := a.Date.In(m.Location)
+	dir := filepath.Join(export.Sanitize(al.Name), local.Format("2006"), local.Format("01"))
+	if err := os.MkdirAll(filepath.Join(m.Root, dir), 0755); err != nil {
+		return Record{}, err
+	}
+
+	name := export.FileName(a, m.Location)
+	rel := filepath.Join(dir, name)
+	for i := 2; fileExists(filepath.Join(m.Root, rel)); i++ {
+		ext := filepath.Ext(name)
+		rel = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name[:len(name)-len(ext)], i, ext))
+	}
+
+	var packet []byte
+	if m.XMP.Embed {
+		if p := xmp.Build(a, al.Name); xmp.CanEmbed(rel, p) {
+			packet = p
+		}
+	}
+	if err := copyFile(src, filepath.Join(m.Root, rel), a.Date, packet); err != nil {
+		return Record{}, err
+	}
+
+	return Record{
+		GUID:       a.GUID,
+		AlbumGUID:  a.AlbumGUID,
+		Path:       rel,
+		Sidecar:    rel + ".json",
+		MirroredAt: time.Now().UTC(),
+	}, nil
+}
+
+// writeSidecars stores the asset's author, comments and captions next to the mirrored file.
+// Embedded XMP is only written on the initial copy, sidecars follow later comments.
+func (m *Mirror) writeSidecars(al *album.Album, a *asset.Asset, record *Record) error {
+	data, err := json.MarshalIndent(export.NewManifestEntry(a, filepath.Base(record.Path)), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(m.Root, record.Sidecar), data); err != nil {
+		return err
+	}
+
+	if !m.XMP.Sidecar {
+		return nil
+	}
+	record.XMPSidecar = xmp.SidecarName(record.Path)
+	return writeFileAtomic(filepath.Join(m.Root, record.XMPSidecar), xmp.Build(a, al.Name))
+}
+
+// commentsStamp hashes everything about an asset's comments that ends up in its sidecars,
+// so edits and a removal paired with an addition are noticed as well
+func commentsStamp(a *asset.Asset) string {
+	keys := make([]string, 0, len(a.Comments))
+	for k := range a.Comments {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, k := range keys {
+		c := a.Comments[k]
+		fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00%t%t\x00%s\x00", c.GUID, c.Date.UnixNano(), c.AuthorID, c.AuthorName, c.IsCaption, c.IsLike, c.Content)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func (m *Mirror) saveIndex() error {
+	data, err := json.MarshalIndent(m.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.Root, indexFile), data)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// copyFile copies through a temporary file so a partial copy never looks mirrored.
+// packet is embedded as XMP when it isn't nil.
+func copyFile(src string, dst string, modified time.Time, packet []byte) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(filepath.Dir(dst), ".mirror-")
+	if err != nil {
+		return err
+	}
+	if err := export.CopyMedia(out, in, packet); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	if err := os.Rename(out.Name(), dst); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Chtimes(dst, modified, modified)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
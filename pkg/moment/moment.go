@@ -0,0 +1,111 @@
+package moment
+
+import (
+	"sort"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/asset"
+)
+
+// Ways assets can be grouped into moments
+const (
+	ByBatch = "batch"
+	ByDay   = "day"
+)
+
+// Moment is a group of assets uploaded together or taken on the same day
+type Moment struct {
+	ID             string      `json:"ID"`
+	Kind           string      `json:"Kind"`
+	Count          int         `json:"Count"`
+	PhotoCount     int         `json:"PhotoCount"`
+	VideoCount     int         `json:"VideoCount"`
+	Author         string      `json:"Author"`
+	AuthorID       string      `json:"AuthorID"`
+	Authors        []string    `json:"Authors"`
+	StartDate      time.Time   `json:"StartDate"`
+	EndDate        time.Time   `json:"EndDate"`
+	Representative asset.Asset `json:"Representative"`
+	AssetGUIDs     []string    `json:"AssetGUIDs"`
+}
+
+// List for sorting moments
+type List []Moment
+
+// Len is part of sort.Interface.
+func (a List) Len() int {
+	return len(a)
+}
+
+// Swap is part of sort.Interface.
+func (a List) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+// Less is part of sort.Interface. Newest moments come first
+func (a List) Less(i, j int) bool {
+	return a[i].EndDate.After(a[j].EndDate)
+}
+
+// Group splits assets into moments by batch or by day, newest first
+func Group(assets []asset.Asset, kind string) List {
+	groups := make(map[string][]asset.Asset)
+	for _, a := range assets {
+		key := a.BatchID
+		if kind == ByDay {
+			key = a.Day
+		}
+		groups[key] = append(groups[key], a)
+	}
+
+	out := make(List, 0, len(groups))
+	for id, members := range groups {
+		out = append(out, newMoment(id, kind, members))
+	}
+	sort.Sort(out)
+	return out
+}
+
+func newMoment(id string, kind string, members []asset.Asset) Moment {
+	// Oldest first so the date range and author order read naturally
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Date.Before(members[j].Date)
+	})
+
+	m := Moment{
+		ID:         id,
+		Kind:       kind,
+		Count:      len(members),
+		Authors:    make([]string, 0),
+		AssetGUIDs: make([]string, 0, len(members)),
+		StartDate:  members[0].Date,
+		EndDate:    members[len(members)-1].Date,
+	}
+
+	postsByAuthor := make(map[string]int)
+	hasPhoto := false
+	for _, a := range members {
+		m.AssetGUIDs = append(m.AssetGUIDs, a.GUID)
+		if a.IsVideo {
+			m.VideoCount++
+		} else {
+			m.PhotoCount++
+		}
+
+		if _, ok := postsByAuthor[a.Author]; !ok {
+			m.Authors = append(m.Authors, a.Author)
+		}
+		postsByAuthor[a.Author]++
+		if postsByAuthor[a.Author] > postsByAuthor[m.Author] || m.Author == "" {
+			m.Author, m.AuthorID = a.Author, a.AuthorID
+		}
+
+		// Represent the moment with its most recent photo, falling back to a video
+		if !a.IsVideo || !hasPhoto {
+			m.Representative = a
+			hasPhoto = hasPhoto || !a.IsVideo
+		}
+	}
+
+	return m
+}
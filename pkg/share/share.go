@@ -0,0 +1,225 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of content a link can expose
+const (
+	KindAlbum = "album"
+	KindAsset = "asset"
+)
+
+var (
+	// ErrInvalid is returned for tokens that are malformed, forged or unknown
+	ErrInvalid = errors.New("invalid share link")
+	// ErrExpired is returned for links past their expiry
+	ErrExpired = errors.New("share link has expired")
+	// ErrRevoked is returned for links an admin has revoked
+	ErrRevoked = errors.New("share link has been revoked")
+)
+
+// Link grants read-only access to an album or a single asset
+type Link struct {
+	ID        string     `json:"ID"`
+	Kind      string     `json:"Kind"`
+	AlbumGUID string     `json:"AlbumGUID"`
+	AssetGUID string     `json:"AssetGUID,omitempty"`
+	Token     string     `json:"Token"`
+	CreatedAt time.Time  `json:"CreatedAt"`
+	ExpiresAt *time.Time `json:"ExpiresAt,omitempty"`
+	RevokedAt *time.Time `json:"RevokedAt,omitempty"`
+}
+
+// Allows reports whether the link exposes the given asset
+func (l Link) Allows(albumGUID string, assetGUID string) bool {
+	if l.AlbumGUID != albumGUID {
+		return false
+	}
+	return l.Kind == KindAlbum || l.AssetGUID == assetGUID
+}
+
+// Store persists share links to a JSON file, along with the secret they are signed with
+type Store struct {
+	path   string
+	secret []byte
+	links  map[string]Link
+	mutex  sync.RWMutex
+}
+
+type storeFile struct {
+	Secret string `json:"Secret"`
+	Links  []Link `json:"Links"`
+}
+
+// Open loads the store at path, creating it with a fresh secret if it doesn't exist.
+// A non-empty secret overrides the stored one, invalidating links signed with another.
+func Open(path string, secret string) (*Store, error) {
+	s := &Store{path: path, links: make(map[string]Link)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var f storeFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("corrupt share store: %w", err)
+		}
+		s.secret = []byte(f.Secret)
+		for _, l := range f.Links {
+			s.links[l.ID] = l
+		}
+	}
+
+	if secret != "" && secret != string(s.secret) {
+		s.secret = []byte(secret)
+		for id, l := range s.links {
+			l.Token = l.ID + "." + s.sign(l)
+			s.links[id] = l
+		}
+	}
+	if len(s.secret) == 0 {
+		s.secret = []byte(randomHex(32))
+	}
+
+	return s, s.save()
+}
+
+// Create mints a link to an album, or to one of its assets when assetGUID is set.
+// A zero ttl never expires.
+func (s *Store) Create(albumGUID string, assetGUID string, ttl time.Duration) (Link, error) {
+	l := Link{
+		ID:        randomHex(12),
+		Kind:      KindAlbum,
+		AlbumGUID: albumGUID,
+		AssetGUID: assetGUID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if assetGUID != "" {
+		l.Kind = KindAsset
+	}
+	if ttl > 0 {
+		expires := l.CreatedAt.Add(ttl)
+		l.ExpiresAt = &expires
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	l.Token = l.ID + "." + s.sign(l)
+	s.links[l.ID] = l
+	return l, s.save()
+}
+
+// Get returns a link by ID
+func (s *Store) Get(id string) (Link, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	l, ok := s.links[id]
+	return l, ok
+}
+
+// Revoke disables a link. Revoked links are kept so they stay listed.
+func (s *Store) Revoke(id string) (Link, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l, ok := s.links[id]
+	if !ok {
+		return Link{}, ErrInvalid
+	}
+	if l.RevokedAt == nil {
+		now := time.Now().UTC()
+		l.RevokedAt = &now
+		s.links[id] = l
+	}
+	return l, s.save()
+}
+
+// List returns every link, newest first
+func (s *Store) List() []Link {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	out := make([]Link, 0, len(s.links))
+	for _, l := range s.links {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out
+}
+
+// Verify checks a token's signature, expiry and revocation, returning the link it grants
+func (s *Store) Verify(token string) (Link, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return Link{}, ErrInvalid
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	l, ok := s.links[parts[0]]
+	if !ok || !hmac.Equal([]byte(parts[1]), []byte(s.sign(l))) {
+		return Link{}, ErrInvalid
+	}
+	if l.RevokedAt != nil {
+		return Link{}, ErrRevoked
+	}
+	if l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt) {
+		return Link{}, ErrExpired
+	}
+	return l, nil
+}
+
+// sign covers everything a link grants, so a stored link can't be widened without the secret
+func (s *Store) sign(l Link) string {
+	expires := ""
+	if l.ExpiresAt != nil {
+		expires = l.ExpiresAt.Format(time.RFC3339Nano)
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", l.ID, l.Kind, l.AlbumGUID, l.AssetGUID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// save writes the store atomically. The caller must hold the lock, or be the only user.
+func (s *Store) save() error {
+	f := storeFile{Secret: string(s.secret), Links: make([]Link, 0, len(s.links))}
+	for _, l := range s.links {
+		f.Links = append(f.Links, l)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
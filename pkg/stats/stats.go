@@ -0,0 +1,101 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+)
+
+// DefaultTopCommented is how many of the most commented assets the API includes
+const DefaultTopCommented = 10
+
+// MonthFormat is the layout of the keys in Stats.ActivityByMonth
+const MonthFormat = "2006-01"
+
+// Stats summarizes the contents and activity of one or more albums
+type Stats struct {
+	AlbumCount       int            `json:"AlbumCount"`
+	AssetCount       int            `json:"AssetCount"`
+	PhotoCount       int            `json:"PhotoCount"`
+	VideoCount       int            `json:"VideoCount"`
+	CommentCount     int            `json:"CommentCount"`
+	LikeCount        int            `json:"LikeCount"`
+	TotalBytes       uint64         `json:"TotalBytes"`
+	PostsByAuthor    map[string]int `json:"PostsByAuthor"`
+	CaptionsByAuthor map[string]int `json:"CaptionsByAuthor"`
+	CommentsByAuthor map[string]int `json:"CommentsByAuthor"`
+	ActivityByMonth  map[string]int `json:"ActivityByMonth"`
+	TopCommented     []Commented    `json:"TopCommented"`
+}
+
+// Commented is an asset ranked by its number of comments
+type Commented struct {
+	GUID         string `json:"GUID"`
+	AlbumGUID    string `json:"AlbumGUID"`
+	Filename     string `json:"Filename"`
+	CommentCount int    `json:"CommentCount"`
+}
+
+// Compute gathers statistics across albums, keeping the top most commented assets.
+// Captions are counted apart from comments, as are likes. Months are bucketed in loc.
+func Compute(albums []*album.Album, top int, loc *time.Location) Stats {
+	s := Stats{
+		AlbumCount:       len(albums),
+		PostsByAuthor:    make(map[string]int),
+		CaptionsByAuthor: make(map[string]int),
+		CommentsByAuthor: make(map[string]int),
+		ActivityByMonth:  make(map[string]int),
+		TopCommented:     make([]Commented, 0),
+	}
+
+	for _, al := range albums {
+		for _, as := range al.Assets {
+			s.AssetCount++
+			if as.IsVideo {
+				s.VideoCount++
+			} else {
+				s.PhotoCount++
+			}
+			s.TotalBytes += as.Size
+			s.PostsByAuthor[as.Author]++
+			s.ActivityByMonth[as.Date.In(loc).Format(MonthFormat)]++
+
+			commentCount := 0
+			for _, c := range as.Comments {
+				switch {
+				case c.IsLike:
+					s.LikeCount++
+				case c.IsCaption:
+					s.CaptionsByAuthor[c.AuthorName]++
+				default:
+					commentCount++
+					s.CommentsByAuthor[c.AuthorName]++
+				}
+				s.ActivityByMonth[c.Date.In(loc).Format(MonthFormat)]++
+			}
+			s.CommentCount += commentCount
+
+			if commentCount > 0 {
+				s.TopCommented = append(s.TopCommented, Commented{
+					GUID:         as.GUID,
+					AlbumGUID:    as.AlbumGUID,
+					Filename:     as.Filename,
+					CommentCount: commentCount,
+				})
+			}
+		}
+	}
+
+	sort.Slice(s.TopCommented, func(i, j int) bool {
+		if s.TopCommented[i].CommentCount != s.TopCommented[j].CommentCount {
+			return s.TopCommented[i].CommentCount > s.TopCommented[j].CommentCount
+		}
+		return s.TopCommented[i].GUID < s.TopCommented[j].GUID
+	})
+	if len(s.TopCommented) > top {
+		s.TopCommented = s.TopCommented[:top]
+	}
+
+	return s
+}
@@ -0,0 +1,187 @@
+package tombstone
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/journal"
+)
+
+// Tombstone records an album, asset or comment that disappeared from the database
+type Tombstone struct {
+	Type      string    `json:"Type"`
+	GUID      string    `json:"GUID"`
+	AlbumGUID string    `json:"AlbumGUID,omitempty"`
+	AssetGUID string    `json:"AssetGUID,omitempty"`
+	RemovedAt time.Time `json:"RemovedAt"`
+
+	// Name is the album's name, the asset's filename or the comment's content, when it was known
+	Name string `json:"Name,omitempty"`
+
+	// Archived is set when a removed asset's media survives in the mirror. Asset is then its last known state.
+	Archived bool         `json:"Archived"`
+	Asset    *asset.Asset `json:"Asset,omitempty"`
+}
+
+func (t Tombstone) key() string {
+	return t.Type + "/" + t.AlbumGUID + "/" + t.AssetGUID + "/" + t.GUID
+}
+
+// List for sorting tombstones
+type List []Tombstone
+
+// Len is part of sort.Interface.
+func (a List) Len() int {
+	return len(a)
+}
+
+// Swap is part of sort.Interface.
+func (a List) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+// Less is part of sort.Interface. Most recent removals come first
+func (a List) Less(i, j int) bool {
+	return a[i].RemovedAt.After(a[j].RemovedAt)
+}
+
+// FromChanges builds tombstones for the deletions among changes, named from the albums as they were before the refresh
+func FromChanges(changes []journal.Change, previous []*album.Album) List {
+	albums := make(map[string]*album.Album, len(previous))
+	for _, a := range previous {
+		albums[a.GUID] = a
+	}
+
+	out := make(List, 0)
+	for _, c := range changes {
+		if !c.Deleted {
+			continue
+		}
+		t := Tombstone{Type: c.Type, GUID: c.GUID, AlbumGUID: c.AlbumGUID, AssetGUID: c.AssetGUID, RemovedAt: c.Date}
+
+		switch c.Type {
+		case journal.TypeAlbum:
+			if a, ok := albums[c.GUID]; ok {
+				t.Name = a.Name
+			}
+		case journal.TypeAsset:
+			if a, ok := albums[c.AlbumGUID]; ok && a.Assets[c.GUID] != nil {
+				t.Asset = a.Assets[c.GUID]
+				t.Name = t.Asset.Filename
+			}
+		case journal.TypeComment:
+			if a, ok := albums[c.AlbumGUID]; ok && a.Assets[c.AssetGUID] != nil {
+				if cm, ok := a.Assets[c.AssetGUID].Comment(c.GUID); ok {
+					t.Name = cm.Content
+				}
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// Store persists tombstones to a JSON file
+type Store struct {
+	path       string
+	tombstones map[string]Tombstone
+	mutex      sync.RWMutex
+}
+
+// Open loads the store at path, creating it if it doesn't exist
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, tombstones: make(map[string]Tombstone)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var stored []Tombstone
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("corrupt tombstone store: %w", err)
+		}
+		for _, t := range stored {
+			s.tombstones[t.key()] = t
+		}
+	}
+	return s, s.save()
+}
+
+// Apply adds the tombstones and drops those of content that came back in changes
+func (s *Store) Apply(tombstones List, changes []journal.Change) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dirty := false
+	for _, c := range changes {
+		if c.Deleted {
+			continue
+		}
+		key := Tombstone{Type: c.Type, GUID: c.GUID, AlbumGUID: c.AlbumGUID, AssetGUID: c.AssetGUID}.key()
+		if _, ok := s.tombstones[key]; ok {
+			delete(s.tombstones, key)
+			dirty = true
+		}
+	}
+	for _, t := range tombstones {
+		// Only archived assets need their last known state
+		if !t.Archived {
+			t.Asset = nil
+		}
+		s.tombstones[t.key()] = t
+		dirty = true
+	}
+
+	if !dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// List returns every tombstone, most recent first
+func (s *Store) List() List {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	out := make(List, 0, len(s.tombstones))
+	for _, t := range s.tombstones {
+		out = append(out, t)
+	}
+	sort.Sort(out)
+	return out
+}
+
+// Archived returns the tombstone of a removed asset whose media is still in the mirror
+func (s *Store) Archived(albumGUID string, assetGUID string) (Tombstone, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	t, ok := s.tombstones[Tombstone{Type: journal.TypeAsset, GUID: assetGUID, AlbumGUID: albumGUID}.key()]
+	return t, ok && t.Archived
+}
+
+// save writes the store atomically. The caller must hold the lock, or be the only user.
+func (s *Store) save() error {
+	stored := make([]Tombstone, 0, len(s.tombstones))
+	for _, t := range s.tombstones {
+		stored = append(stored, t)
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
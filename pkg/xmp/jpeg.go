@@ -0,0 +1,108 @@
+package xmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// xmpNamespace prefixes XMP packets stored in a JPEG APP1 segment
+var xmpNamespace = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// maxSegmentPayload is the largest packet a single APP1 segment can hold
+const maxSegmentPayload = 65533
+
+// ErrNotJPEG is returned when embedding into something that isn't a JPEG
+var ErrNotJPEG = errors.New("not a JPEG file")
+
+// ErrPacketTooLarge is returned when the packet doesn't fit in one segment
+var ErrPacketTooLarge = errors.New("XMP packet too large to embed")
+
+// IsJPEG reports whether a file name looks like a JPEG
+func IsJPEG(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// CanEmbed reports whether packet can be embedded into the named file
+func CanEmbed(name string, packet []byte) bool {
+	return IsJPEG(name) && len(xmpNamespace)+len(packet) <= maxSegmentPayload
+}
+
+// EmbedJPEG copies a JPEG from src to dst with packet stored as its XMP segment.
+// An existing XMP segment is replaced, everything else is copied untouched.
+// The header is parsed before anything is written, so dst is left untouched when src turns out not to be a JPEG.
+func EmbedJPEG(dst io.Writer, src io.Reader, packet []byte) error {
+	if len(xmpNamespace)+len(packet) > maxSegmentPayload {
+		return ErrPacketTooLarge
+	}
+
+	r := bufio.NewReader(src)
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return ErrNotJPEG
+	}
+	var head bytes.Buffer
+	head.Write(soi)
+
+	written := false
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header[:2]); err != nil || header[0] != 0xFF {
+			return ErrNotJPEG
+		}
+		marker := header[1]
+
+		// Keep APP0 (JFIF) and APP1 (Exif) first, as readers expect, then add ours
+		if !written && marker != 0xE0 && marker != 0xE1 {
+			writeSegment(&head, packet)
+			written = true
+		}
+
+		// Start of scan: the rest of the file is image data
+		if marker == 0xDA {
+			head.Write(header[:2])
+			if _, err := head.WriteTo(dst); err != nil {
+				return err
+			}
+			_, err := io.Copy(dst, r)
+			return err
+		}
+
+		if _, err := io.ReadFull(r, header[2:4]); err != nil {
+			return ErrNotJPEG
+		}
+		length := int(binary.BigEndian.Uint16(header[2:4]))
+		if length < 2 {
+			return ErrNotJPEG
+		}
+		body := make([]byte, length-2)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return ErrNotJPEG
+		}
+
+		// Drop the old XMP segment, ours replaces it
+		if marker == 0xE1 && bytes.HasPrefix(body, xmpNamespace) {
+			continue
+		}
+		head.Write(header)
+		head.Write(body)
+	}
+}
+
+func writeSegment(dst io.Writer, packet []byte) error {
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(2+len(xmpNamespace)+len(packet)))
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	if _, err := dst.Write(xmpNamespace); err != nil {
+		return err
+	}
+	_, err := dst.Write(packet)
+	return err
+}
@@ -0,0 +1,107 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/comment"
+)
+
+// Options controls how XMP metadata is written alongside exported or mirrored files
+type Options struct {
+	// Sidecar writes a .xmp file next to each media file
+	Sidecar bool
+	// Embed writes the packet into JPEG files themselves
+	Embed bool
+}
+
+// SidecarName returns the sidecar file name for a media file, e.g. IMG_0001.JPG -> IMG_0001.JPG.xmp.
+// The extension is kept so the photo and video of a Live Photo get a sidecar each.
+func SidecarName(name string) string {
+	return name + ".xmp"
+}
+
+// Build returns an XMP packet describing who posted the asset, its captions and comments.
+// Standard fields are used where importers look for them, the full thread goes in the airphoto namespace.
+func Build(a *asset.Asset, albumName string) []byte {
+	comments := make([]*comment.Comment, 0, len(a.Comments))
+	for _, c := range a.Comments {
+		comments = append(comments, c)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].Date.Before(comments[j].Date)
+	})
+
+	captions := make([]string, 0)
+	for _, c := range comments {
+		if c.IsCaption && c.Content != "" {
+			captions = append(captions, c.Content)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` + "\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`  <rdf:Description rdf:about=""` + "\n")
+	b.WriteString(`    xmlns:dc="http://purl.org/dc/elements/1.1/"` + "\n")
+	b.WriteString(`    xmlns:xmp="http://ns.adobe.com/xap/1.0/"` + "\n")
+	b.WriteString(`    xmlns:lr="http://ns.adobe.com/lightroom/1.0/"` + "\n")
+	b.WriteString(`    xmlns:airphoto="https://airphoto.app/ns/1.0/"` + "\n")
+	fmt.Fprintf(&b, "    xmp:CreateDate=%q\n", a.Date.Format(time.RFC3339))
+	fmt.Fprintf(&b, "    airphoto:AssetGUID=\"%s\"\n", escape(a.GUID))
+	fmt.Fprintf(&b, "    airphoto:AlbumGUID=\"%s\"\n", escape(a.AlbumGUID))
+	fmt.Fprintf(&b, "    airphoto:Album=\"%s\">\n", escape(albumName))
+
+	b.WriteString("   <dc:creator>\n    <rdf:Seq>\n")
+	fmt.Fprintf(&b, "     <rdf:li>%s</rdf:li>\n", escape(a.Author))
+	b.WriteString("    </rdf:Seq>\n   </dc:creator>\n")
+
+	if len(captions) > 0 {
+		b.WriteString("   <dc:description>\n    <rdf:Alt>\n")
+		fmt.Fprintf(&b, "     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n", escape(strings.Join(captions, "\n")))
+		b.WriteString("    </rdf:Alt>\n   </dc:description>\n")
+	}
+
+	b.WriteString("   <dc:subject>\n    <rdf:Bag>\n")
+	fmt.Fprintf(&b, "     <rdf:li>%s</rdf:li>\n", escape(albumName))
+	b.WriteString("    </rdf:Bag>\n   </dc:subject>\n")
+	b.WriteString("   <lr:hierarchicalSubject>\n    <rdf:Bag>\n")
+	fmt.Fprintf(&b, "     <rdf:li>Shared Albums|%s</rdf:li>\n", escape(strings.Replace(albumName, "|", "_", -1)))
+	b.WriteString("    </rdf:Bag>\n   </lr:hierarchicalSubject>\n")
+
+	if len(comments) > 0 {
+		b.WriteString("   <airphoto:Comments>\n    <rdf:Seq>\n")
+		for _, c := range comments {
+			kind := "comment"
+			switch {
+			case c.IsLike:
+				kind = "like"
+			case c.IsCaption:
+				kind = "caption"
+			}
+			fmt.Fprintf(&b, "     <rdf:li rdf:parseType=\"Resource\">\n")
+			fmt.Fprintf(&b, "      <airphoto:Type>%s</airphoto:Type>\n", kind)
+			fmt.Fprintf(&b, "      <airphoto:Author>%s</airphoto:Author>\n", escape(c.AuthorName))
+			fmt.Fprintf(&b, "      <airphoto:Date>%s</airphoto:Date>\n", c.Date.Format(time.RFC3339))
+			fmt.Fprintf(&b, "      <airphoto:Content>%s</airphoto:Content>\n", escape(c.Content))
+			fmt.Fprintf(&b, "     </rdf:li>\n")
+		}
+		b.WriteString("    </rdf:Seq>\n   </airphoto:Comments>\n")
+	}
+
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>`)
+	return b.Bytes()
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
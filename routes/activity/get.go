@@ -0,0 +1,63 @@
+package activity
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/activity"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// Get returns every asset post, comment, caption and like across all albums, newest first.
+// Optional query parameters: "since" (RFC3339), "limit" and "tz".
+func Get(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		srv.Mutex.RLock()
+		events := activity.FromAlbums(srv.AlbumsFor(r))
+		srv.Mutex.RUnlock()
+
+		if s := r.URL.Query().Get("since"); s != "" {
+			since, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			filtered := events[:0]
+			for _, e := range events {
+				if e.Date.After(since) {
+					filtered = append(filtered, e)
+				}
+			}
+			events = filtered
+		}
+
+		for i := range events {
+			events[i].Date = events[i].Date.In(loc)
+		}
+
+		sort.Sort(events)
+
+		if l := r.URL.Query().Get("limit"); l != "" {
+			limit, err := strconv.Atoi(l)
+			if err != nil || limit < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if limit < len(events) {
+				events = events[:limit]
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	}
+}
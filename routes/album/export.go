@@ -0,0 +1,83 @@
+package album
+
+import (
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/export"
+	"github.com/qcasey/airphoto-server/server"
+	"github.com/rs/zerolog/log"
+)
+
+// parseExportDate accepts RFC3339 or a plain day in loc. A plain "to" day includes the whole day.
+func parseExportDate(value string, loc *time.Location, isEnd bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(asset.DayFormat, value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if isEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// GetExport streams an album's originals and a comments manifest as a ZIP archive.
+// Optional query parameters: "from", "to" (RFC3339 or YYYY-MM-DD) and "author" (name or ID).
+func GetExport(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		from, err := parseExportDate(query.Get("from"), srv.Location, false)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		to, err := parseExportDate(query.Get("to"), srv.Location, true)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter := export.Filter{From: from, To: to, Author: query.Get("author")}
+
+		// Collect assets up front so the lock isn't held while streaming
+		srv.Mutex.RLock()
+		var (
+			name   string
+			assets []*asset.Asset
+		)
+		params := mux.Vars(r)
+		for _, a := range srv.AlbumsFor(r) {
+			if a.GUID == params["guid"] {
+				name = a.Name
+				assets = make([]*asset.Asset, 0, len(a.Assets))
+				for _, as := range a.Assets {
+					if filter.Match(as) {
+						assets = append(assets, as)
+					}
+				}
+				break
+			}
+		}
+		srv.Mutex.RUnlock()
+
+		if assets == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+		if err := export.WriteZip(w, name, assets, srv.MediaDir(), srv.Location, srv.XMPOptions()); err != nil {
+			// Headers are already sent, all we can do is cut the archive short
+			log.Error().Err(err).Msgf("Failed to export album %s", params["guid"])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package album
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/qcasey/airphoto-server/pkg/asset"
+)
+
+// assetFilter builds a predicate from the request's "hasLocation", "isVideo" and "camera" query parameters
+func assetFilter(r *http.Request) (func(*asset.Asset) bool, error) {
+	query := r.URL.Query()
+	var predicates []func(*asset.Asset) bool
+
+	if v := query.Get("hasLocation"); v != "" {
+		want, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, func(a *asset.Asset) bool {
+			return a.HasLocation() == want
+		})
+	}
+
+	if v := query.Get("isVideo"); v != "" {
+		want, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, func(a *asset.Asset) bool {
+			return a.IsVideo == want
+		})
+	}
+
+	if v := query.Get("camera"); v != "" {
+		predicates = append(predicates, func(a *asset.Asset) bool {
+			return a.Metadata != nil && strings.EqualFold(a.Metadata.CameraModel, v)
+		})
+	}
+
+	return func(a *asset.Asset) bool {
+		for _, p := range predicates {
+			if !p(a) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -13,16 +13,33 @@ import (
 
 func Get(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		include, err := assetFilter(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		srv.Mutex.RLock()
 		defer srv.Mutex.RUnlock()
 
 		params := mux.Vars(r)
-		for _, a := range srv.Albums {
+		for _, a := range srv.AlbumsFor(r) {
 			if a.GUID == params["guid"] {
+				if server.NotModified(w, r, srv.AlbumVersion(a.GUID)) {
+					return
+				}
+
 				// Sort assets
-				assets := make(asset.List, len(a.Assets))
+				assets := make(asset.List, 0, len(a.Assets))
 				for _, asset := range a.Assets {
-					assets = append(assets, *asset)
+					if include(asset) {
+						assets = append(assets, asset.In(loc))
+					}
 				}
 				sort.Sort(assets)
 				w.Header().Set("Content-Type", "application/json")
@@ -37,23 +54,50 @@ func Get(srv *server.Server) http.HandlerFunc {
 
 func GetAll(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		srv.Mutex.RLock()
 		defer srv.Mutex.RUnlock()
+
+		visible := srv.AlbumsFor(r)
+		if server.NotModified(w, r, srv.AlbumsVersion(visible)) {
+			return
+		}
+
+		albums := make(album.List, 0, len(visible))
+		for _, a := range visible {
+			albums = append(albums, a.In(loc))
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(srv.Albums)
+		json.NewEncoder(w).Encode(albums)
 	}
 }
 
 func GetList(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		srv.Mutex.RLock()
 		defer srv.Mutex.RUnlock()
 
-		assetlessAlbums := make(album.List, 0, len(srv.Albums))
-		for _, a := range srv.Albums {
+		visible := srv.AlbumsFor(r)
+		if server.NotModified(w, r, srv.AlbumsVersion(visible)) {
+			return
+		}
+
+		assetlessAlbums := make(album.List, 0, len(visible))
+		for _, a := range visible {
 			a2 := *a
 			a2.Assets = nil
-			assetlessAlbums = append(assetlessAlbums, a2)
+			assetlessAlbums = append(assetlessAlbums, a2.In(loc))
 		}
 		sort.Sort(assetlessAlbums)
 		w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,50 @@
+package album
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/moment"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// GetMoments returns an album's assets grouped by upload batch (default) or by day with "?by=day"
+func GetMoments(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		kind := r.URL.Query().Get("by")
+		switch kind {
+		case "":
+			kind = moment.ByBatch
+		case moment.ByBatch, moment.ByDay:
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		params := mux.Vars(r)
+		for _, a := range srv.AlbumsFor(r) {
+			if a.GUID == params["guid"] {
+				assets := make([]asset.Asset, 0, len(a.Assets))
+				for _, asset := range a.Assets {
+					assets = append(assets, asset.In(loc))
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(moment.Group(assets, kind))
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
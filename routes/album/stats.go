@@ -0,0 +1,30 @@
+package album
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/stats"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// GetStats returns statistics for a single album
+func GetStats(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		params := mux.Vars(r)
+		for _, a := range srv.AlbumsFor(r) {
+			if a.GUID == params["guid"] {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(stats.Compute([]*album.Album{a}, stats.DefaultTopCommented, srv.Location))
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,109 @@
+package album
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/album"
+	v1 "github.com/qcasey/airphoto-server/pkg/api/v1"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// GetV1 returns an album's assets, newest first, filtered like Get
+func GetV1(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		include, err := assetFilter(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		params := mux.Vars(r)
+		for _, a := range srv.AlbumsFor(r) {
+			if a.GUID == params["guid"] {
+				if server.NotModified(w, r, srv.AlbumVersion(a.GUID)) {
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(v1.NewAssets(a.Assets, loc, include))
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// GetAllV1 returns every album with its assets, newest first
+func GetAllV1(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		visible := srv.AlbumsFor(r)
+		if server.NotModified(w, r, srv.AlbumsVersion(visible)) {
+			return
+		}
+
+		albums := make([]v1.AlbumWithAssets, 0, len(visible))
+		for _, a := range newestFirst(visible) {
+			albums = append(albums, v1.NewAlbumWithAssets(a, loc))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(albums)
+	}
+}
+
+// GetListV1 returns every album without its assets, newest first
+func GetListV1(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		visible := srv.AlbumsFor(r)
+		if server.NotModified(w, r, srv.AlbumsVersion(visible)) {
+			return
+		}
+
+		albums := make([]v1.Album, 0, len(visible))
+		for _, a := range newestFirst(visible) {
+			albums = append(albums, v1.NewAlbum(a, loc))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(albums)
+	}
+}
+
+// newestFirst returns a sorted copy of albums, leaving the server's slice alone
+func newestFirst(albums []*album.Album) []*album.Album {
+	sorted := append([]*album.Album(nil), albums...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].LastPhotoDate.Equal(sorted[j].LastPhotoDate) {
+			return sorted[i].LastPhotoDate.After(sorted[j].LastPhotoDate)
+		}
+		return sorted[i].GUID < sorted[j].GUID
+	})
+	return sorted
+}
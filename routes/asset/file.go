@@ -0,0 +1,59 @@
+package asset
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/media"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// findAsset looks up an asset within an album the request may see. The caller must hold srv.Mutex.
+func findAsset(srv *server.Server, r *http.Request, albumGUID string, assetGUID string) *asset.Asset {
+	for _, a := range srv.AlbumsFor(r) {
+		if a.GUID == albumGUID {
+			return a.Assets[assetGUID]
+		}
+	}
+	return nil
+}
+
+// GetFile serves an asset's media file. "?variant=" selects a rendition by type or GUID, defaulting to the original.
+// Removed assets are served from the mirror when they were archived there.
+func GetFile(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+
+		srv.Mutex.RLock()
+		a := findAsset(srv, r, params["guid"], params["asset"])
+		if a == nil {
+			srv.Mutex.RUnlock()
+			serveArchived(srv, w, r, params["guid"], params["asset"])
+			return
+		}
+		found := *a
+		srv.Mutex.RUnlock()
+
+		media.Serve(w, r, srv.MediaDir(), &found, r.URL.Query().Get("variant"))
+	}
+}
+
+// serveArchived serves the mirrored original of an asset that was removed from iCloud
+func serveArchived(srv *server.Server, w http.ResponseWriter, r *http.Request, albumGUID string, assetGUID string) {
+	if srv.Mirror == nil || !server.RequestKey(r).AllowsAlbum(albumGUID) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, ok := srv.Tombstones.Archived(albumGUID, assetGUID); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	record, ok := srv.Mirror.Mirrored(assetGUID)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(srv.Mirror.Root, record.Path))
+}
@@ -0,0 +1,110 @@
+package delta
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	v1 "github.com/qcasey/airphoto-server/pkg/api/v1"
+	"github.com/qcasey/airphoto-server/pkg/journal"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// Get returns what changed since the "since" cursor. Without one, or with an expired one, everything is returned.
+func Get(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var changes []journal.Change
+		cursor, full := srv.Journal.Cursor(), true
+		if since := r.URL.Query().Get("since"); since != "" {
+			changes, cursor, err = srv.Journal.Since(since)
+			switch {
+			case errors.Is(err, journal.ErrExpired):
+				// Fall back to a full sync, the client learns from "full"
+				cursor, err = srv.Journal.Cursor(), nil
+			case err != nil:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			default:
+				full = false
+			}
+		}
+
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		albums := make(map[string]*album.Album)
+		for _, a := range srv.AlbumsFor(r) {
+			albums[a.GUID] = a
+		}
+
+		delta := v1.NewDelta(cursor, full)
+		if full {
+			for _, a := range albums {
+				delta.Albums = append(delta.Albums, v1.NewAlbum(a, loc))
+				delta.Assets = append(delta.Assets, v1.NewAssets(a.Assets, loc, nil)...)
+			}
+		} else {
+			key := server.RequestKey(r)
+			for _, c := range changes {
+				if key.AllowsAlbum(albumOf(c)) {
+					addChange(&delta, c, albums, loc)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(delta)
+	}
+}
+
+// addChange adds the current state of a changed album, asset or comment, or its tombstone.
+// Changes to content that has since disappeared are left to the tombstone recorded after them.
+func addChange(delta *v1.Delta, c journal.Change, albums map[string]*album.Album, loc *time.Location) {
+	if c.Deleted {
+		delta.Deleted = append(delta.Deleted, v1.Tombstone{
+			Type:      c.Type,
+			GUID:      c.GUID,
+			AlbumGUID: c.AlbumGUID,
+			AssetGUID: c.AssetGUID,
+			Date:      c.Date.In(loc),
+		})
+		return
+	}
+
+	switch c.Type {
+	case journal.TypeAlbum:
+		if a, ok := albums[c.GUID]; ok {
+			delta.Albums = append(delta.Albums, v1.NewAlbum(a, loc))
+		}
+	case journal.TypeAsset:
+		if a, ok := albums[c.AlbumGUID]; ok {
+			if as, ok := a.Assets[c.GUID]; ok {
+				delta.Assets = append(delta.Assets, v1.NewAsset(as, loc))
+			}
+		}
+	case journal.TypeComment:
+		if a, ok := albums[c.AlbumGUID]; ok {
+			if as, ok := a.Assets[c.AssetGUID]; ok {
+				if cm, ok := as.Comment(c.GUID); ok {
+					delta.Comments = append(delta.Comments, v1.NewComment(cm, loc))
+				}
+			}
+		}
+	}
+}
+
+// albumOf returns the album a change belongs to
+func albumOf(c journal.Change) string {
+	if c.Type == journal.TypeAlbum {
+		return c.GUID
+	}
+	return c.AlbumGUID
+}
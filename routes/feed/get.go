@@ -0,0 +1,50 @@
+package feed
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/activity"
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/apikey"
+	"github.com/qcasey/airphoto-server/pkg/feed"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// Get returns an Atom feed of recent posts and comments, for one album when the route has a "guid" or for all albums
+func Get(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.Mutex.RLock()
+		guid, single := mux.Vars(r)["guid"]
+		albums := srv.AlbumsFor(r)
+		title, id := "Shared Albums", "urn:airphoto:feed"
+		if single {
+			albums = nil
+			for _, a := range srv.AlbumsFor(r) {
+				if a.GUID == guid {
+					albums = []*album.Album{a}
+					title, id = a.Name, "urn:airphoto:feed:"+a.GUID
+					break
+				}
+			}
+		}
+		events := activity.FromAlbums(albums)
+		srv.Mutex.RUnlock()
+
+		if single && albums == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		sort.Sort(events)
+		base := srv.BaseURL(r)
+		withMedia := server.RequestKey(r).Allows(apikey.ScopeMedia)
+		f := feed.Build(id, title, base+r.URL.RequestURI(), base, r.URL.Query().Get("token"), withMedia, events)
+
+		w.Header().Set("Content-Type", feed.ContentType)
+		w.Write([]byte(xml.Header))
+		xml.NewEncoder(w).Encode(f)
+	}
+}
@@ -0,0 +1,63 @@
+package geo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/geo"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// Get returns geotagged assets as GeoJSON, from one album when the route has a "guid" or from all albums.
+// "?zoom=" clusters nearby assets for that map zoom level.
+func Get(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		zoom := -1
+		if z := r.URL.Query().Get("zoom"); z != "" {
+			zoom, err = strconv.Atoi(z)
+			if err != nil || zoom < 0 || zoom > geo.MaxZoom {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		guid, single := mux.Vars(r)["guid"]
+		assets := make([]*asset.Asset, 0)
+		found := false
+		for _, a := range srv.AlbumsFor(r) {
+			if single && a.GUID != guid {
+				continue
+			}
+			found = true
+			for _, as := range a.Assets {
+				assets = append(assets, as)
+			}
+		}
+		if single && !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var fc geo.FeatureCollection
+		if zoom >= 0 {
+			fc = geo.Cluster(assets, zoom, loc)
+		} else {
+			fc = geo.Collect(assets, loc)
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(fc)
+	}
+}
@@ -0,0 +1,88 @@
+package gql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// maxDepth stops clients from nesting album -> asset -> album indefinitely
+const maxDepth = 12
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler serves GraphQL queries as JSON, over GET or POST.
+// Subscriptions are streamed as server-sent events when the client accepts text/event-stream.
+func Handler(srv *server.Server) http.HandlerFunc {
+	schema := graphql.MustParseSchema(schema, &resolver{srv: srv}, graphql.MaxDepth(maxDepth))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		} else {
+			q := r.URL.Query()
+			req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+			if v := q.Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		if req.Query == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			subscribe(w, r, schema, req)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables))
+	}
+}
+
+// subscribe streams each response as a "next" event until the client disconnects
+func subscribe(w http.ResponseWriter, r *http.Request, schema *graphql.Schema, req request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	responses, err := schema.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for resp := range responses {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	fmt.Fprint(w, "event: complete\ndata:\n\n")
+	flusher.Flush()
+}
@@ -0,0 +1,528 @@
+package gql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/comment"
+	"github.com/qcasey/airphoto-server/pkg/media"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// maxPageSize caps "first" on connections
+const maxPageSize = 500
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type resolver struct {
+	srv *server.Server
+}
+
+// albums snapshots the albums the request's key may see. Published albums are never modified,
+// so resolvers can keep reading them without holding the lock.
+func (r *resolver) albums(ctx context.Context) []*album.Album {
+	r.srv.Mutex.RLock()
+	defer r.srv.Mutex.RUnlock()
+	visible := r.srv.AlbumsForKey(server.ContextKey(ctx))
+	out := make([]*album.Album, len(visible))
+	copy(out, visible)
+	return out
+}
+
+func (r *resolver) findAlbum(ctx context.Context, guid string) *album.Album {
+	for _, a := range r.albums(ctx) {
+		if a.GUID == guid {
+			return a
+		}
+	}
+	return nil
+}
+
+func (r *resolver) Albums(ctx context.Context) []*albumResolver {
+	albums := r.albums(ctx)
+	sort.SliceStable(albums, func(i, j int) bool {
+		if !albums[i].LastPhotoDate.Equal(albums[j].LastPhotoDate) {
+			return albums[i].LastPhotoDate.After(albums[j].LastPhotoDate)
+		}
+		return albums[i].GUID < albums[j].GUID
+	})
+	out := make([]*albumResolver, 0, len(albums))
+	for _, a := range albums {
+		out = append(out, &albumResolver{root: r, album: a})
+	}
+	return out
+}
+
+func (r *resolver) Album(ctx context.Context, args struct{ GUID graphql.ID }) *albumResolver {
+	if a := r.findAlbum(ctx, string(args.GUID)); a != nil {
+		return &albumResolver{root: r, album: a}
+	}
+	return nil
+}
+
+func (r *resolver) Asset(ctx context.Context, args struct {
+	AlbumGUID graphql.ID
+	GUID      graphql.ID
+}) *assetResolver {
+	a := r.findAlbum(ctx, string(args.AlbumGUID))
+	if a == nil {
+		return nil
+	}
+	if as, ok := a.Assets[string(args.GUID)]; ok {
+		return &assetResolver{root: r, album: a, asset: as}
+	}
+	return nil
+}
+
+// People lists everyone who posted or commented, by AuthorID
+func (r *resolver) People(ctx context.Context) []*personResolver {
+	names := make(map[string]string)
+	for _, a := range r.albums(ctx) {
+		for _, as := range a.Assets {
+			names[as.AuthorID] = as.Author
+			for _, c := range as.Comments {
+				names[c.AuthorID] = c.AuthorName
+			}
+		}
+	}
+
+	delete(names, "")
+	out := make([]*personResolver, 0, len(names))
+	for id, name := range names {
+		out = append(out, &personResolver{root: r, id: id, name: name})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].name != out[j].name {
+			return out[i].name < out[j].name
+		}
+		return out[i].id < out[j].id
+	})
+	return out
+}
+
+func (r *resolver) Me() *personResolver {
+	r.srv.Mutex.RLock()
+	defer r.srv.Mutex.RUnlock()
+	if !r.srv.Owner.Known() {
+		return nil
+	}
+	return &personResolver{root: r, id: r.srv.Owner.AuthorID, name: r.srv.Owner.Name}
+}
+
+// Refreshed streams refresh events until the subscription's context ends
+func (r *resolver) Refreshed(ctx context.Context) <-chan *refreshResolver {
+	events, unsubscribe := r.srv.SubscribeRefresh()
+	out := make(chan *refreshResolver)
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				select {
+				case out <- &refreshResolver{event: e}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+type refreshResolver struct {
+	event server.RefreshEvent
+}
+
+func (r *refreshResolver) Date() graphql.Time {
+	return graphql.Time{Time: r.event.Date}
+}
+
+func (r *refreshResolver) AlbumCount() int32 {
+	return int32(r.event.AlbumCount)
+}
+
+func (r *refreshResolver) AssetCount() int32 {
+	return int32(r.event.AssetCount)
+}
+
+type albumResolver struct {
+	root  *resolver
+	album *album.Album
+}
+
+func (r *albumResolver) GUID() graphql.ID {
+	return graphql.ID(r.album.GUID)
+}
+
+func (r *albumResolver) Name() string {
+	return r.album.Name
+}
+
+func (r *albumResolver) URL() string {
+	return r.album.URL
+}
+
+func (r *albumResolver) LastPhotoDate() graphql.Time {
+	return graphql.Time{Time: r.album.LastPhotoDate}
+}
+
+func (r *albumResolver) CoverAsset() *assetResolver {
+	if as, ok := r.album.Assets[r.album.CoverGUID]; ok {
+		return &assetResolver{root: r.root, album: r.album, asset: as}
+	}
+	return nil
+}
+
+type pageArgs struct {
+	First *int32
+	After *string
+}
+
+func (r *albumResolver) Assets(args pageArgs) (*assetConnectionResolver, error) {
+	assets := make([]*asset.Asset, 0, len(r.album.Assets))
+	for _, as := range r.album.Assets {
+		assets = append(assets, as)
+	}
+	// Assets of a batch often share a sorting date, the GUID keeps pages stable between requests
+	sort.SliceStable(assets, func(i, j int) bool {
+		if !assets[i].SortingDate.Equal(assets[j].SortingDate) {
+			return assets[i].SortingDate.After(assets[j].SortingDate)
+		}
+		return assets[i].GUID < assets[j].GUID
+	})
+
+	guids := make([]string, len(assets))
+	for i, as := range assets {
+		guids[i] = as.GUID
+	}
+	start, end, err := paginate(guids, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &assetConnectionResolver{total: len(assets), hasNext: end < len(assets)}
+	for _, as := range assets[start:end] {
+		c.edges = append(c.edges, &assetEdgeResolver{
+			cursor: encodeCursor(as.GUID),
+			node:   &assetResolver{root: r.root, album: r.album, asset: as},
+		})
+	}
+	return c, nil
+}
+
+type assetResolver struct {
+	root  *resolver
+	album *album.Album
+	asset *asset.Asset
+}
+
+func (r *assetResolver) GUID() graphql.ID {
+	return graphql.ID(r.asset.GUID)
+}
+
+func (r *assetResolver) Album() *albumResolver {
+	return &albumResolver{root: r.root, album: r.album}
+}
+
+func (r *assetResolver) Date() graphql.Time {
+	return graphql.Time{Time: r.asset.Date}
+}
+
+func (r *assetResolver) SortingDate() graphql.Time {
+	return graphql.Time{Time: r.asset.SortingDate}
+}
+
+func (r *assetResolver) Day() string {
+	return r.asset.Day
+}
+
+func (r *assetResolver) Author() *personResolver {
+	return &personResolver{root: r.root, id: r.asset.AuthorID, name: r.asset.Author}
+}
+
+func (r *assetResolver) IsMine() bool {
+	return r.asset.IsMine
+}
+
+func (r *assetResolver) IsVideo() bool {
+	return r.asset.IsVideo
+}
+
+func (r *assetResolver) Filename() string {
+	return r.asset.Filename
+}
+
+func (r *assetResolver) MIME() string {
+	return r.asset.MIME
+}
+
+func (r *assetResolver) Width() int32 {
+	return int32(r.asset.Width)
+}
+
+func (r *assetResolver) Height() int32 {
+	return int32(r.asset.Height)
+}
+
+func (r *assetResolver) Size() float64 {
+	return float64(r.asset.Size)
+}
+
+func (r *assetResolver) URL() string {
+	return media.FileURL(r.asset.AlbumGUID, r.asset.GUID, "")
+}
+
+func (r *assetResolver) ThumbnailURL() string {
+	return media.FileURL(r.asset.AlbumGUID, r.asset.GUID, asset.VariantDerivative)
+}
+
+func (r *assetResolver) CameraModel() *string {
+	if r.asset.Metadata == nil || r.asset.Metadata.CameraModel == "" {
+		return nil
+	}
+	return &r.asset.Metadata.CameraModel
+}
+
+func (r *assetResolver) Location() *locationResolver {
+	if !r.asset.HasLocation() {
+		return nil
+	}
+	l := r.asset.Metadata.Location
+	return &locationResolver{latitude: l.Latitude, longitude: l.Longitude, altitude: l.Altitude}
+}
+
+func (r *assetResolver) Comments(args pageArgs) (*commentConnectionResolver, error) {
+	comments := make([]*comment.Comment, 0, len(r.asset.Comments))
+	for _, c := range r.asset.Comments {
+		comments = append(comments, c)
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		if !comments[i].Date.Equal(comments[j].Date) {
+			return comments[i].Date.Before(comments[j].Date)
+		}
+		return comments[i].GUID < comments[j].GUID
+	})
+
+	guids := make([]string, len(comments))
+	for i, c := range comments {
+		guids[i] = c.GUID
+	}
+	start, end, err := paginate(guids, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &commentConnectionResolver{total: len(comments), hasNext: end < len(comments)}
+	for _, cm := range comments[start:end] {
+		c.edges = append(c.edges, &commentEdgeResolver{
+			cursor: encodeCursor(cm.GUID),
+			node:   &commentResolver{root: r.root, comment: cm},
+		})
+	}
+	return c, nil
+}
+
+type locationResolver struct {
+	latitude, longitude, altitude float64
+}
+
+func (r *locationResolver) Latitude() float64 {
+	return r.latitude
+}
+
+func (r *locationResolver) Longitude() float64 {
+	return r.longitude
+}
+
+func (r *locationResolver) Altitude() float64 {
+	return r.altitude
+}
+
+type commentResolver struct {
+	root    *resolver
+	comment *comment.Comment
+}
+
+func (r *commentResolver) GUID() graphql.ID {
+	return graphql.ID(r.comment.GUID)
+}
+
+func (r *commentResolver) Date() graphql.Time {
+	return graphql.Time{Time: r.comment.Date}
+}
+
+func (r *commentResolver) Author() *personResolver {
+	return &personResolver{root: r.root, id: r.comment.AuthorID, name: r.comment.AuthorName}
+}
+
+func (r *commentResolver) IsMine() bool {
+	return r.comment.IsMine
+}
+
+func (r *commentResolver) IsCaption() bool {
+	return r.comment.IsCaption
+}
+
+func (r *commentResolver) IsLike() bool {
+	return r.comment.IsLike
+}
+
+func (r *commentResolver) Content() string {
+	return r.comment.Content
+}
+
+type personResolver struct {
+	root *resolver
+	id   string
+	name string
+}
+
+func (r *personResolver) ID() string {
+	return r.id
+}
+
+func (r *personResolver) Name() string {
+	return r.name
+}
+
+func (r *personResolver) IsMe() bool {
+	r.root.srv.Mutex.RLock()
+	defer r.root.srv.Mutex.RUnlock()
+	return r.root.srv.Owner.Matches(r.id, r.name)
+}
+
+type pageInfoResolver struct {
+	hasNext   bool
+	endCursor *string
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNext
+}
+
+func (r *pageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+type assetConnectionResolver struct {
+	total   int
+	hasNext bool
+	edges   []*assetEdgeResolver
+}
+
+func (r *assetConnectionResolver) TotalCount() int32 {
+	return int32(r.total)
+}
+
+func (r *assetConnectionResolver) Edges() []*assetEdgeResolver {
+	return r.edges
+}
+
+func (r *assetConnectionResolver) PageInfo() *pageInfoResolver {
+	p := &pageInfoResolver{hasNext: r.hasNext}
+	if len(r.edges) > 0 {
+		p.endCursor = &r.edges[len(r.edges)-1].cursor
+	}
+	return p
+}
+
+type assetEdgeResolver struct {
+	cursor string
+	node   *assetResolver
+}
+
+func (r *assetEdgeResolver) Cursor() string {
+	return r.cursor
+}
+
+func (r *assetEdgeResolver) Node() *assetResolver {
+	return r.node
+}
+
+type commentConnectionResolver struct {
+	total   int
+	hasNext bool
+	edges   []*commentEdgeResolver
+}
+
+func (r *commentConnectionResolver) TotalCount() int32 {
+	return int32(r.total)
+}
+
+func (r *commentConnectionResolver) Edges() []*commentEdgeResolver {
+	return r.edges
+}
+
+func (r *commentConnectionResolver) PageInfo() *pageInfoResolver {
+	p := &pageInfoResolver{hasNext: r.hasNext}
+	if len(r.edges) > 0 {
+		p.endCursor = &r.edges[len(r.edges)-1].cursor
+	}
+	return p
+}
+
+type commentEdgeResolver struct {
+	cursor string
+	node   *commentResolver
+}
+
+func (r *commentEdgeResolver) Cursor() string {
+	return r.cursor
+}
+
+func (r *commentEdgeResolver) Node() *commentResolver {
+	return r.node
+}
+
+// Cursors are the GUID of the last item seen, so pages stay stable across refreshes
+func encodeCursor(guid string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(guid))
+}
+
+// paginate returns the range of guids after the cursor, at most "first" long
+func paginate(guids []string, args pageArgs) (int, int, error) {
+	start := 0
+	if args.After != nil {
+		raw, err := base64.RawURLEncoding.DecodeString(*args.After)
+		if err != nil {
+			return 0, 0, errInvalidCursor
+		}
+		start = -1
+		for i, guid := range guids {
+			if guid == string(raw) {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return 0, 0, errInvalidCursor
+		}
+	}
+
+	size := maxPageSize
+	if args.First != nil {
+		if *args.First < 0 {
+			return 0, 0, errors.New("first must not be negative")
+		}
+		if int(*args.First) < size {
+			size = int(*args.First)
+		}
+	}
+
+	end := start + size
+	if end > len(guids) {
+		end = len(guids)
+	}
+	return start, end, nil
+}
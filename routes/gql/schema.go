@@ -0,0 +1,111 @@
+package gql
+
+// schema describes the same in-memory album model the REST endpoints serve
+const schema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+scalar Time
+
+type Query {
+	albums: [Album!]!
+	album(guid: ID!): Album
+	asset(albumGUID: ID!, guid: ID!): Asset
+	people: [Person!]!
+	me: Person
+}
+
+type Subscription {
+	# Emits after every refresh of the albums from the database
+	refreshed: RefreshEvent!
+}
+
+type RefreshEvent {
+	date: Time!
+	albumCount: Int!
+	assetCount: Int!
+}
+
+type Album {
+	guid: ID!
+	name: String!
+	url: String!
+	lastPhotoDate: Time!
+	coverAsset: Asset
+	# Newest first
+	assets(first: Int, after: String): AssetConnection!
+}
+
+type Asset {
+	guid: ID!
+	album: Album!
+	date: Time!
+	sortingDate: Time!
+	day: String!
+	author: Person!
+	isMine: Boolean!
+	isVideo: Boolean!
+	filename: String!
+	mime: String!
+	width: Int!
+	height: Int!
+	size: Float!
+	url: String!
+	thumbnailURL: String!
+	cameraModel: String
+	location: Location
+	# Oldest first
+	comments(first: Int, after: String): CommentConnection!
+}
+
+type Location {
+	latitude: Float!
+	longitude: Float!
+	altitude: Float!
+}
+
+type Comment {
+	guid: ID!
+	date: Time!
+	author: Person!
+	isMine: Boolean!
+	isCaption: Boolean!
+	isLike: Boolean!
+	content: String!
+}
+
+type Person {
+	id: String!
+	name: String!
+	isMe: Boolean!
+}
+
+type PageInfo {
+	hasNextPage: Boolean!
+	endCursor: String
+}
+
+type AssetConnection {
+	totalCount: Int!
+	edges: [AssetEdge!]!
+	pageInfo: PageInfo!
+}
+
+type AssetEdge {
+	cursor: String!
+	node: Asset!
+}
+
+type CommentConnection {
+	totalCount: Int!
+	edges: [CommentEdge!]!
+	pageInfo: PageInfo!
+}
+
+type CommentEdge {
+	cursor: String!
+	node: Comment!
+}
+`
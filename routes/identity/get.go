@@ -0,0 +1,24 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// Get returns the account owner, as configured or detected from the latest refresh
+func Get(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		if !srv.Owner.Known() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(srv.Owner)
+	}
+}
@@ -0,0 +1,27 @@
+package keys
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/apikey"
+	"github.com/qcasey/airphoto-server/server"
+	"github.com/rs/zerolog/log"
+)
+
+// Delete removes an API key created through the admin endpoints. Configured keys can't be deleted.
+func Delete(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch err := srv.Keys.Delete(mux.Vars(r)["name"]); err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case apikey.ErrNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case apikey.ErrReadOnly:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			log.Error().Err(err).Msg("Could not save API keys")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
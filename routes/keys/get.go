@@ -0,0 +1,16 @@
+package keys
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// GetList returns every API key with its usage, never including secrets
+func GetList(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(srv.Keys.List())
+	}
+}
@@ -0,0 +1,59 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/qcasey/airphoto-server/pkg/apikey"
+	"github.com/qcasey/airphoto-server/server"
+	"github.com/rs/zerolog/log"
+)
+
+type createRequest struct {
+	Name   string
+	Scopes []string
+	Albums []string
+}
+
+type createResponse struct {
+	apikey.Key
+	// Secret is only ever returned here
+	Secret string `json:"Secret"`
+}
+
+// Post creates an API key with the given scopes and optional album allow-list,
+// which can't be wider than those of the key making the request
+func Post(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !server.RequestKey(r).Covers(apikey.Key{Scopes: req.Scopes, Albums: req.Albums}) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		key, secret, err := srv.Keys.Create(req.Name, req.Scopes, req.Albums)
+		switch {
+		case err == nil:
+		case errors.Is(err, apikey.ErrExists):
+			w.WriteHeader(http.StatusConflict)
+			return
+		case errors.Is(err, apikey.ErrInvalidScope), req.Name == "":
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		default:
+			log.Error().Err(err).Msg("Could not save API key")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		key.Hash = ""
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(createResponse{Key: key, Secret: secret})
+	}
+}
@@ -0,0 +1,47 @@
+package removed
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/qcasey/airphoto-server/pkg/journal"
+	"github.com/qcasey/airphoto-server/pkg/tombstone"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// GetList returns the removed albums, assets and comments the request may see, most recent first.
+// "?type=" narrows it to albums, assets or comments, and "?archived=true" to assets still in the mirror.
+func GetList(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := server.RequestLocation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		kind, archivedOnly := query.Get("type"), query.Get("archived") == "true"
+		key := server.RequestKey(r)
+
+		out := make(tombstone.List, 0)
+		for _, t := range srv.Tombstones.List() {
+			album := t.AlbumGUID
+			if t.Type == journal.TypeAlbum {
+				album = t.GUID
+			}
+			if !key.AllowsAlbum(album) || (kind != "" && t.Type != kind) || (archivedOnly && !t.Archived) {
+				continue
+			}
+
+			t.RemovedAt = t.RemovedAt.In(loc)
+			if t.Asset != nil {
+				localized := t.Asset.In(loc)
+				t.Asset = &localized
+			}
+			out = append(out, t)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
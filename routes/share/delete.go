@@ -0,0 +1,36 @@
+package share
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/share"
+	"github.com/qcasey/airphoto-server/server"
+	"github.com/rs/zerolog/log"
+)
+
+// Delete revokes a share link of an album the key may see. It stays listed, marked with its revocation time.
+func Delete(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if link, ok := srv.Shares.Get(id); !ok || !server.RequestKey(r).AllowsAlbum(link.AlbumGUID) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		link, err := srv.Shares.Revoke(id)
+		if err == share.ErrInvalid {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Could not save share link")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newLinkResponse(srv, r, link))
+	}
+}
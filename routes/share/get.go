@@ -0,0 +1,35 @@
+package share
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/qcasey/airphoto-server/pkg/share"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// linkResponse is a share link along with the absolute URL to hand out
+type linkResponse struct {
+	share.Link
+	URL string `json:"URL"`
+}
+
+func newLinkResponse(srv *server.Server, r *http.Request, l share.Link) linkResponse {
+	return linkResponse{Link: l, URL: srv.BaseURL(r) + "/s/" + l.Token}
+}
+
+// GetList returns every share link of the albums the key may see, including expired and revoked ones
+func GetList(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := server.RequestKey(r)
+		links := srv.Shares.List()
+		out := make([]linkResponse, 0, len(links))
+		for _, l := range links {
+			if key.AllowsAlbum(l.AlbumGUID) {
+				out = append(out, newLinkResponse(srv, r, l))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
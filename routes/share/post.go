@@ -0,0 +1,64 @@
+package share
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/qcasey/airphoto-server/server"
+	"github.com/rs/zerolog/log"
+)
+
+type createRequest struct {
+	AlbumGUID string
+	AssetGUID string
+	// ExpiresIn is a Go duration such as "72h", empty never expires
+	ExpiresIn string
+}
+
+// Post mints a share link for an album, or a single asset when AssetGUID is given
+func Post(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AlbumGUID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var ttl time.Duration
+		if req.ExpiresIn != "" {
+			var err error
+			if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Only mint links for content that exists and the key may see
+		srv.Mutex.RLock()
+		exists := false
+		for _, a := range srv.AlbumsFor(r) {
+			if a.GUID == req.AlbumGUID {
+				_, hasAsset := a.Assets[req.AssetGUID]
+				exists = req.AssetGUID == "" || hasAsset
+				break
+			}
+		}
+		srv.Mutex.RUnlock()
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		link, err := srv.Shares.Create(req.AlbumGUID, req.AssetGUID, ttl)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not save share link")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newLinkResponse(srv, r, link))
+	}
+}
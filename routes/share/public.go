@@ -0,0 +1,208 @@
+package share
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/qcasey/airphoto-server/pkg/asset"
+	"github.com/qcasey/airphoto-server/pkg/comment"
+	"github.com/qcasey/airphoto-server/pkg/media"
+	"github.com/qcasey/airphoto-server/pkg/share"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// shared is the content a share link exposes. Only Assets is shown to visitors,
+// media holds the full assets files are served from.
+type shared struct {
+	Token  string        `json:"-"`
+	Name   string        `json:"Name"`
+	Assets []publicAsset `json:"Assets"`
+	media  []asset.Asset
+}
+
+// publicAsset is what visitors of a share link see of an asset.
+// Emails, person IDs, locations and file internals are left out.
+type publicAsset struct {
+	GUID     string          `json:"GUID"`
+	Date     time.Time       `json:"Date"`
+	Author   string          `json:"Author"`
+	IsVideo  bool            `json:"IsVideo"`
+	Width    uint64          `json:"Width"`
+	Height   uint64          `json:"Height"`
+	Caption  string          `json:"Caption"`
+	Variants []publicVariant `json:"Variants"`
+	Comments []publicComment `json:"Comments"`
+}
+
+type publicVariant struct {
+	Type   string `json:"Type"`
+	Width  uint64 `json:"Width"`
+	Height uint64 `json:"Height"`
+}
+
+// publicComment is a comment or like, oldest first
+type publicComment struct {
+	Date       time.Time `json:"Date"`
+	AuthorName string    `json:"Name"`
+	IsLike     bool      `json:"IsLike"`
+	Content    string    `json:"Content"`
+}
+
+func newPublicAsset(a *asset.Asset) publicAsset {
+	out := publicAsset{
+		GUID:     a.GUID,
+		Date:     a.Date,
+		Author:   a.Author,
+		IsVideo:  a.IsVideo,
+		Width:    a.Width,
+		Height:   a.Height,
+		Variants: make([]publicVariant, 0, len(a.Variants)),
+		Comments: make([]publicComment, 0, len(a.Comments)),
+	}
+	for _, v := range a.Variants {
+		out.Variants = append(out.Variants, publicVariant{Type: v.Type, Width: v.Width, Height: v.Height})
+	}
+
+	comments := make([]*comment.Comment, 0, len(a.Comments))
+	for _, c := range a.Comments {
+		comments = append(comments, c)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].Date.Equal(comments[j].Date) {
+			return comments[i].Date.Before(comments[j].Date)
+		}
+		return comments[i].GUID < comments[j].GUID
+	})
+	for _, c := range comments {
+		if c.IsCaption {
+			out.Caption = c.Content
+			continue
+		}
+		out.Comments = append(out.Comments, publicComment{Date: c.Date, AuthorName: c.AuthorName, IsLike: c.IsLike, Content: c.Content})
+	}
+	return out
+}
+
+// resolve verifies the link in the route and copies out what it exposes, newest first.
+// It writes the error response itself and returns false when the link isn't usable.
+func resolve(srv *server.Server, w http.ResponseWriter, r *http.Request) (shared, bool) {
+	token := mux.Vars(r)["token"]
+	link, err := srv.Shares.Verify(token)
+	switch err {
+	case nil:
+	case share.ErrExpired, share.ErrRevoked:
+		w.WriteHeader(http.StatusGone)
+		return shared{}, false
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return shared{}, false
+	}
+
+	srv.Mutex.RLock()
+	defer srv.Mutex.RUnlock()
+
+	for _, a := range srv.Albums {
+		if a.GUID != link.AlbumGUID {
+			continue
+		}
+		out := shared{Token: token, Name: a.Name, media: make([]asset.Asset, 0)}
+		for _, as := range a.Assets {
+			if link.Allows(as.AlbumGUID, as.GUID) {
+				out.media = append(out.media, *as)
+			}
+		}
+		if len(out.media) == 0 && link.Kind == share.KindAsset {
+			break
+		}
+		sort.Sort(asset.List(out.media))
+		out.Assets = make([]publicAsset, 0, len(out.media))
+		for i := range out.media {
+			out.Assets = append(out.Assets, newPublicAsset(&out.media[i]))
+		}
+		return out, true
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	return shared{}, false
+}
+
+// GetJSON returns the shared album or asset as read-only JSON
+func GetJSON(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		content, ok := resolve(srv, w, r)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(content)
+	}
+}
+
+// GetFile serves the derivative of a shared asset, refusing anything outside the link's scope.
+// Originals are never shared: their EXIF and QuickTime metadata can carry the location publicAsset leaves out.
+func GetFile(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		content, ok := resolve(srv, w, r)
+		if !ok {
+			return
+		}
+		guid := mux.Vars(r)["asset"]
+		for i := range content.media {
+			if content.media[i].GUID == guid {
+				media.Serve(w, r, srv.MediaDir(), &content.media[i], asset.VariantDerivative)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var viewTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>{{.Name}}</title>
+	<style>
+		body { margin: 0 auto; max-width: 960px; padding: 1rem; font-family: -apple-system, sans-serif; background: #111; color: #eee; }
+		figure { margin: 0 0 2rem; }
+		img, video { display: block; max-width: 100%; margin: 0 auto; }
+		figcaption, li { color: #aaa; }
+		ul { padding-left: 1rem; }
+	</style>
+</head>
+<body>
+	<h1>{{.Name}}</h1>
+	{{range .Assets}}
+	<figure>
+		{{if .IsVideo}}
+		<video controls preload="metadata" src="/s/{{$.Token}}/assets/{{.GUID}}/file"></video>
+		{{else}}
+		<a href="/s/{{$.Token}}/assets/{{.GUID}}/file"><img loading="lazy" alt="{{.Caption}}" src="/s/{{$.Token}}/assets/{{.GUID}}/file"></a>
+		{{end}}
+		<figcaption>{{.Author}} · {{.Date.Format "Jan 2, 2006"}}</figcaption>
+		<ul>
+			{{if .Caption}}<li><strong>{{.Caption}}</strong></li>{{end}}
+			{{range .Comments}}{{if not .IsLike}}<li>{{.AuthorName}}: {{.Content}}</li>{{end}}{{end}}
+		</ul>
+	</figure>
+	{{end}}
+</body>
+</html>
+`))
+
+// View renders the shared album or asset as a simple HTML page
+func View(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		content, ok := resolve(srv, w, r)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		viewTemplate.Execute(w, content)
+	}
+}
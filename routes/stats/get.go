@@ -0,0 +1,20 @@
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/qcasey/airphoto-server/pkg/stats"
+	"github.com/qcasey/airphoto-server/server"
+)
+
+// Get returns statistics across every album
+func Get(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.Mutex.RLock()
+		defer srv.Mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats.Compute(srv.AlbumsFor(r), stats.DefaultTopCommented, srv.Location))
+	}
+}
@@ -0,0 +1,244 @@
+(function () {
+	"use strict";
+
+	var PAGE_SIZE = 60;
+	var TOKEN_KEY = "airphoto.token";
+
+	var albumsEl = document.getElementById("albums");
+	var assetsEl = document.getElementById("assets");
+	var statusEl = document.getElementById("status");
+	var titleEl = document.getElementById("title");
+	var sentinel = document.getElementById("sentinel");
+	var lightbox = document.getElementById("lightbox");
+
+	var state = { album: null, assets: [], rendered: 0, current: -1 };
+
+	function token() {
+		var t = localStorage.getItem(TOKEN_KEY);
+		if (t === null) {
+			t = window.prompt("API token") || "";
+			localStorage.setItem(TOKEN_KEY, t);
+		}
+		return t;
+	}
+
+	// Media is loaded by <img> and <video>, which can't send headers, so the token goes in the query
+	function fileURL(asset, variant) {
+		var url = "../albums/" + encodeURIComponent(asset.AlbumGUID) + "/assets/" + encodeURIComponent(asset.GUID) + "/file";
+		var params = new URLSearchParams();
+		if (variant) {
+			params.set("variant", variant);
+		}
+		params.set("token", token());
+		return url + "?" + params.toString();
+	}
+
+	function api(path) {
+		return fetch(".." + path, { headers: { "Authorization": "Bearer " + token() } }).then(function (resp) {
+			if (resp.status === 401 || resp.status === 403) {
+				localStorage.removeItem(TOKEN_KEY);
+				throw new Error("The token was rejected, reload to enter another.");
+			}
+			if (!resp.ok) {
+				throw new Error(resp.status + " " + resp.statusText);
+			}
+			return resp.json();
+		});
+	}
+
+	function el(tag, className, text) {
+		var node = document.createElement(tag);
+		if (className) {
+			node.className = className;
+		}
+		if (text) {
+			node.textContent = text;
+		}
+		return node;
+	}
+
+	function formatDate(value) {
+		return new Date(value).toLocaleString();
+	}
+
+	function fail(err) {
+		statusEl.textContent = err.message;
+	}
+
+	function showAlbums() {
+		state.album = null;
+		titleEl.textContent = "";
+		assetsEl.hidden = true;
+		albumsEl.hidden = false;
+		statusEl.textContent = "Loading albums…";
+
+		api("/albums").then(function (albums) {
+			albumsEl.replaceChildren();
+			albums.forEach(function (album) {
+				var card = el("article", "album");
+				var img = el("img");
+				img.loading = "lazy";
+				img.alt = album.Name;
+				if (album.CoverGUID) {
+					img.src = fileURL({ AlbumGUID: album.GUID, GUID: album.CoverGUID }, "derivative");
+				}
+				card.appendChild(img);
+				card.appendChild(el("h2", null, album.Name));
+				card.appendChild(el("p", null, "Updated " + formatDate(album.LastPhotoDate)));
+				card.addEventListener("click", function () {
+					location.hash = "#/albums/" + encodeURIComponent(album.GUID);
+				});
+				albumsEl.appendChild(card);
+			});
+			statusEl.textContent = albums.length ? "" : "No albums yet.";
+		}).catch(fail);
+	}
+
+	function showAlbum(guid) {
+		state = { album: guid, assets: [], rendered: 0, current: -1 };
+		albumsEl.hidden = true;
+		assetsEl.hidden = false;
+		assetsEl.replaceChildren();
+		statusEl.textContent = "Loading photos…";
+
+		api("/albums").then(function (albums) {
+			albums.forEach(function (album) {
+				if (album.GUID === guid) {
+					titleEl.textContent = album.Name;
+				}
+			});
+		}).catch(function () {});
+
+		api("/albums/" + encodeURIComponent(guid)).then(function (assets) {
+			state.assets = assets;
+			statusEl.textContent = assets.length ? "" : "This album is empty.";
+			renderMore();
+		}).catch(fail);
+	}
+
+	// Infinite scroll: render the next page whenever the sentinel comes into view
+	function renderMore() {
+		if (state.album === null) {
+			return;
+		}
+		var end = Math.min(state.rendered + PAGE_SIZE, state.assets.length);
+		for (var i = state.rendered; i < end; i++) {
+			assetsEl.appendChild(tile(state.assets[i], i));
+		}
+		state.rendered = end;
+	}
+
+	function tile(asset, index) {
+		var node = el("div", "tile");
+		var img = el("img");
+		img.loading = "lazy";
+		img.alt = asset.Filename;
+		img.src = fileURL(asset, "derivative");
+		node.appendChild(img);
+
+		var comments = Object.keys(asset.Comments || {}).length;
+		if (asset.IsVideo) {
+			node.appendChild(el("span", "badge", "▶"));
+		} else if (comments > 0) {
+			node.appendChild(el("span", "badge", "💬 " + comments));
+		}
+		node.addEventListener("click", function () {
+			open(index);
+		});
+		return node;
+	}
+
+	function open(index) {
+		if (index < 0 || index >= state.assets.length) {
+			return;
+		}
+		state.current = index;
+		var asset = state.assets[index];
+		var media = document.getElementById("media");
+		media.replaceChildren();
+
+		if (asset.IsVideo) {
+			var video = el("video");
+			video.controls = true;
+			video.autoplay = true;
+			video.playsInline = true;
+			video.src = fileURL(asset);
+			media.appendChild(video);
+		} else {
+			var img = el("img");
+			img.alt = asset.Filename;
+			img.src = fileURL(asset);
+			media.appendChild(img);
+		}
+
+		var comments = Object.keys(asset.Comments || {}).map(function (key) {
+			return asset.Comments[key];
+		}).sort(function (a, b) {
+			return new Date(a.Date) - new Date(b.Date);
+		});
+
+		var captions = comments.filter(function (c) { return c.IsCaption; });
+		document.getElementById("caption").textContent = captions.map(function (c) { return c.Content; }).join(" ");
+		document.getElementById("meta").textContent = asset.Author + " · " + formatDate(asset.Date);
+
+		var list = document.getElementById("comments");
+		list.replaceChildren();
+		comments.forEach(function (c) {
+			if (c.IsCaption) {
+				return;
+			}
+			var item = el("li");
+			item.appendChild(el("span", "author", c.Name));
+			item.appendChild(el("span", null, c.IsLike ? "♥ liked this" : c.Content));
+			list.appendChild(item);
+		});
+
+		lightbox.hidden = false;
+	}
+
+	function close() {
+		lightbox.hidden = true;
+		state.current = -1;
+		document.getElementById("media").replaceChildren();
+	}
+
+	function route() {
+		close();
+		var match = location.hash.match(/^#\/albums\/(.+)$/);
+		if (match) {
+			showAlbum(decodeURIComponent(match[1]));
+		} else {
+			showAlbums();
+		}
+	}
+
+	document.getElementById("close").addEventListener("click", close);
+	document.getElementById("prev").addEventListener("click", function () { open(state.current - 1); });
+	document.getElementById("next").addEventListener("click", function () { open(state.current + 1); });
+	document.getElementById("logout").addEventListener("click", function () {
+		localStorage.removeItem(TOKEN_KEY);
+		token();
+		route();
+	});
+	document.addEventListener("keydown", function (e) {
+		if (lightbox.hidden) {
+			return;
+		}
+		if (e.key === "Escape") {
+			close();
+		} else if (e.key === "ArrowLeft") {
+			open(state.current - 1);
+		} else if (e.key === "ArrowRight") {
+			open(state.current + 1);
+		}
+	});
+
+	new IntersectionObserver(function (entries) {
+		if (entries[0].isIntersecting) {
+			renderMore();
+		}
+	}).observe(sentinel);
+
+	window.addEventListener("hashchange", route);
+	route();
+})();
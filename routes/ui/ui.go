@@ -0,0 +1,20 @@
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the web gallery. It only talks to the REST endpoints, so it needs no server state.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded directory is fixed at compile time
+		panic(err)
+	}
+	return http.FileServer(http.FS(files))
+}
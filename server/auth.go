@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/apikey"
+	"github.com/rs/zerolog/log"
+)
+
+type contextKey int
+
+const keyContextKey contextKey = iota
+
+// RequestToken returns the token a request was made with, from an "Authorization: Bearer" header
+// or, for clients that can't set headers such as <img> tags and feed readers, the "token" query parameter.
+func RequestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// RequestKey returns the API key a request was authenticated with
+func RequestKey(r *http.Request) apikey.Key {
+	return ContextKey(r.Context())
+}
+
+// ContextKey returns the API key stored in a request's context by Authenticate
+func ContextKey(ctx context.Context) apikey.Key {
+	if k, ok := ctx.Value(keyContextKey).(apikey.Key); ok {
+		return k
+	}
+	return apikey.Key{}
+}
+
+// configuredKeys reads the "apiKeys" config section. The legacy "token" setting becomes an admin key named "default".
+func (s *Server) configuredKeys() ([]apikey.Key, error) {
+	var keys []apikey.Key
+	if err := s.Viper.UnmarshalKey("apiKeys", &keys); err != nil {
+		return nil, err
+	}
+	if token := s.Viper.GetString("token"); token != "" {
+		keys = append(keys, apikey.Key{Name: "default", Secret: token, Scopes: []string{apikey.ScopeAdmin}})
+	}
+	return keys, nil
+}
+
+// ensureKey generates an admin key when none are configured, so a fresh install isn't left open.
+// Like share secrets it's stored for later runs, but as a hash, so the token is only logged this once.
+func (s *Server) ensureKey() error {
+	if !s.Keys.Empty() {
+		return nil
+	}
+	_, secret, err := s.Keys.Create("default", []string{apikey.ScopeAdmin}, nil)
+	if err != nil {
+		return err
+	}
+	log.Warn().Str("token", secret).Msg("No API keys are configured, generated an admin token. It is only shown now, set token in the config to choose your own.")
+	return nil
+}
+
+// Authenticate rejects requests without a known API key and logs usage per key
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := s.Keys.Authenticate(RequestToken(r))
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		log.Info().Str("key", key.Name).Str("method", r.Method).Str("path", r.URL.Path).Msg("API request")
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyContextKey, key)))
+	})
+}
+
+// Require wraps a handler so it's only reachable with a key granted scope
+func (s *Server) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !RequestKey(r).Allows(scope) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// AlbumsFor returns the albums the request's key may see. The caller must hold s.Mutex.
+func (s *Server) AlbumsFor(r *http.Request) []*album.Album {
+	return s.AlbumsForKey(RequestKey(r))
+}
+
+// AlbumsForKey returns the albums key may see. The caller must hold s.Mutex.
+func (s *Server) AlbumsForKey(key apikey.Key) []*album.Album {
+	if len(key.Albums) == 0 {
+		return s.Albums
+	}
+	out := make([]*album.Album, 0, len(key.Albums))
+	for _, a := range s.Albums {
+		if key.AllowsAlbum(a.GUID) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -10,21 +10,57 @@ import (
 func Read() *viper.Viper {
 	// any approach to require this configuration into your program.
 
-	pflag.String("port", ":1459", "Port to bind server to")
+	pflag.Int("port", 1459, "Port to bind server to")
 	pflag.String("db", "", "Path to your iCloud db (typically ~/Library/Messages/chat.db)")
-	pflag.String("token", "UNIQUE_UUID_OR_OTHER_TOKEN", "Token to validate requests against")
-	pflag.String("recheckInterval", "20000", "Interval in milliseconds to check for album updates")
+	pflag.String("token", "", "Admin token to validate requests against, generated and logged once when no keys exist. See apiKeys in the config for scoped keys")
+	pflag.Bool("dbSnapshotCopy", false, "Parse each refresh from a private copy of the db instead of the live file")
+	pflag.Bool("dbImmutable", false, "Open the db as immutable, skipping SQLite's locking. Reads can be stale or torn if iCloud writes meanwhile, and the -wal file is ignored, by dbSnapshotCopy's copies as well")
+	pflag.String("dbSnapshotDir", "", "Directory for the db copies (defaults to the system's temporary directory)")
+	pflag.Int("recheckInterval", 20000, "Interval in milliseconds to check for album updates")
+	pflag.String("mediaDir", "", "Directory holding the album media files (defaults to the db's directory)")
+	pflag.Bool("extractMetadata", true, "Read EXIF and video metadata from the media files")
+	pflag.String("mirrorDir", "", "Directory to continuously back up album media to, disabled when empty")
+	pflag.Bool("mirrorDelete", false, "Remove mirrored files once they disappear from iCloud")
+	pflag.Bool("xmpSidecar", true, "Write XMP sidecars with captions and comments when exporting or mirroring")
+	pflag.Bool("xmpEmbed", false, "Embed XMP captions and comments into exported and mirrored JPEGs")
+	pflag.String("publicURL", "", "Absolute URL the server is reachable at, used for links in feeds")
+	pflag.String("keysFile", "./keys.json", "File storing API keys created through the admin endpoints")
+	pflag.String("shareFile", "./shares.json", "File storing public share links")
+	pflag.String("shareSecret", "", "Secret share links are signed with, generated and stored when empty")
+	pflag.String("journalFile", "./journal.json", "File storing the change journal offline clients sync from")
+	pflag.String("tombstoneFile", "./tombstones.json", "File storing removed albums, assets and comments")
+	pflag.String("timezone", "America/Los_Angeles", "IANA time zone for logs and day grouping")
+	pflag.String("ownerName", "", "Display name of the account owner, overrides detection")
+	pflag.String("ownerID", "", "Person ID of the account owner, overrides detection")
 	pflag.Parse()
-	viper.BindPFlags(pflag.CommandLine)
 
 	newConfig := viper.New()
+	newConfig.BindPFlags(pflag.CommandLine)
 	newConfig.SetConfigName("config") // name of config file (without extension)
 	newConfig.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
 	newConfig.AddConfigPath(".")      // optionally look for config in the working directory
 	newConfig.SetDefault("db", "")
 	newConfig.SetDefault("port", 1459)
 	newConfig.SetDefault("recheckInterval", 20000)
-	newConfig.SetDefault("token", "UNIQUE_UUID_OR_OTHER_TOKEN")
+	newConfig.SetDefault("dbSnapshotCopy", false)
+	newConfig.SetDefault("dbImmutable", false)
+	newConfig.SetDefault("dbSnapshotDir", "")
+	newConfig.SetDefault("token", "")
+	newConfig.SetDefault("mediaDir", "")
+	newConfig.SetDefault("extractMetadata", true)
+	newConfig.SetDefault("mirrorDir", "")
+	newConfig.SetDefault("mirrorDelete", false)
+	newConfig.SetDefault("xmpSidecar", true)
+	newConfig.SetDefault("xmpEmbed", false)
+	newConfig.SetDefault("publicURL", "")
+	newConfig.SetDefault("keysFile", "./keys.json")
+	newConfig.SetDefault("shareFile", "./shares.json")
+	newConfig.SetDefault("shareSecret", "")
+	newConfig.SetDefault("journalFile", "./journal.json")
+	newConfig.SetDefault("tombstoneFile", "./tombstones.json")
+	newConfig.SetDefault("timezone", "America/Los_Angeles")
+	newConfig.SetDefault("ownerName", "")
+	newConfig.SetDefault("ownerID", "")
 
 	err := newConfig.ReadInConfig() // Find and read the config file
 	if err != nil {                 // Handle errors reading the config file
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"time"
+)
+
+// RefreshEvent is published after every refresh of the albums
+type RefreshEvent struct {
+	Date       time.Time
+	AlbumCount int
+	AssetCount int
+}
+
+// SubscribeRefresh returns a channel receiving refresh events and a function to stop receiving them.
+// Slow subscribers miss events rather than holding up refreshes.
+func (s *Server) SubscribeRefresh() (<-chan RefreshEvent, func()) {
+	ch := make(chan RefreshEvent, 1)
+
+	s.subscribersMutex.Lock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan RefreshEvent]struct{})
+	}
+	s.subscribers[ch] = struct{}{}
+	s.subscribersMutex.Unlock()
+
+	return ch, func() {
+		s.subscribersMutex.Lock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+		s.subscribersMutex.Unlock()
+	}
+}
+
+func (s *Server) publishRefresh(e RefreshEvent) {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/media"
+	"github.com/rs/zerolog/log"
+)
+
+// extractMetadata reads capture, camera, location and video details from each asset's original file.
+// Results are cached, so only new or modified files are read on refresh.
+func (srv *Server) extractMetadata(albums []*album.Album) {
+	if !srv.Viper.GetBool("extractMetadata") {
+		return
+	}
+
+	mediaDir := srv.MediaDir()
+	extracted := 0
+	for _, al := range albums {
+		for _, a := range al.Assets {
+			path, err := media.FindOriginal(mediaDir, a)
+			if err != nil {
+				continue
+			}
+
+			m, err := srv.metadata.Get(path)
+			if err != nil {
+				log.Debug().Err(err).Str("path", path).Msg("Could not read media metadata")
+				continue
+			}
+			a.Metadata = m
+			extracted++
+		}
+	}
+
+	log.Info().Msgf("Read metadata for %d assets.", extracted)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/journal"
+	"github.com/qcasey/airphoto-server/pkg/tombstone"
+	"github.com/rs/zerolog/log"
+)
+
+// recordRemovals keeps tombstones for the deletions a refresh found.
+// Removed assets still held by the mirror are archived rather than lost.
+func (srv *Server) recordRemovals(changes []journal.Change, previous []*album.Album) {
+	tombstones := tombstone.FromChanges(changes, previous)
+	for i, t := range tombstones {
+		if t.Type != journal.TypeAsset || srv.Mirror == nil {
+			continue
+		}
+		record, mirrored := srv.Mirror.Mirrored(t.GUID)
+		if t.Asset == nil && record.Asset != nil {
+			// After a restart the previous albums are unknown, the mirror remembers what it copied
+			tombstones[i].Asset, tombstones[i].Name = record.Asset, record.Asset.Filename
+		}
+		// An archived tombstone promises the asset's last known state
+		tombstones[i].Archived = mirrored && tombstones[i].Asset != nil
+	}
+
+	if err := srv.Tombstones.Apply(tombstones, changes); err != nil {
+		log.Error().Err(err).Msg("Failed to save tombstones")
+	}
+	if len(tombstones) > 0 {
+		log.Info().Msgf("Found %d removed albums, assets and comments.", len(tombstones))
+	}
+
+	if srv.Viper.GetBool("useFirebase") {
+		srv.notifyRemovals(tombstones, previous)
+	}
+}
+
+// notifyRemovals sends one notification per album that was removed or lost assets
+func (srv *Server) notifyRemovals(tombstones tombstone.List, previous []*album.Album) {
+	names := make(map[string]string, len(previous))
+	for _, a := range previous {
+		names[a.GUID] = a.Name
+	}
+
+	removedAlbums := make(map[string]bool)
+	removedAssets := make(map[string]int)
+	for _, t := range tombstones {
+		switch t.Type {
+		case journal.TypeAlbum:
+			removedAlbums[t.GUID] = true
+		case journal.TypeAsset:
+			removedAssets[t.AlbumGUID]++
+		}
+	}
+
+	for guid := range removedAlbums {
+		srv.sendNotification(names[guid], "The album was removed")
+	}
+	for guid, count := range removedAssets {
+		if removedAlbums[guid] {
+			continue
+		}
+		message := "A photo was removed"
+		if count > 1 {
+			message = fmt.Sprintf("%d photos were removed", count)
+		}
+		srv.sendNotification(names[guid], message)
+	}
+}
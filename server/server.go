@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +16,14 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/qcasey/airphoto-server/internal/database"
 	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/qcasey/airphoto-server/pkg/apikey"
+	"github.com/qcasey/airphoto-server/pkg/identity"
+	"github.com/qcasey/airphoto-server/pkg/journal"
+	"github.com/qcasey/airphoto-server/pkg/metadata"
+	"github.com/qcasey/airphoto-server/pkg/mirror"
+	"github.com/qcasey/airphoto-server/pkg/share"
+	"github.com/qcasey/airphoto-server/pkg/tombstone"
+	"github.com/qcasey/airphoto-server/pkg/xmp"
 	"github.com/qcasey/airphoto-server/server/config"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -27,15 +37,44 @@ type Server struct {
 	// Main map and submaps of parsed album data
 	Albums []*album.Album
 
+	// Version stamps of each album by GUID, and when albums were last added or removed
+	versions    map[string]Version
+	setModified time.Time
+
 	// Device Tokens for firebase messaging
 	DeviceTokens []string
 	useFirebase  bool
 
 	Started bool
 
-	// DeterminedName is the user's name derived from comment's "IsMine" bool.
-	DeterminedName string
-	Mutex          sync.RWMutex
+	// Location is the configured time zone, used for logging and day buckets
+	Location *time.Location
+
+	// Cache of metadata read from the media files
+	metadata *metadata.Cache
+
+	// Mirror keeps a local copy of the albums, nil unless mirrorDir is configured
+	Mirror *mirror.Mirror
+
+	// Shares are the public links minted for albums and assets
+	Shares *share.Store
+
+	// Keys are the API keys requests authenticate with
+	Keys *apikey.Store
+
+	// Journal records what changed between refreshes, for clients syncing a local copy
+	Journal *journal.Journal
+
+	// Tombstones remember removed content, and archive removed assets the mirror still holds
+	Tombstones *tombstone.Store
+
+	// Listeners for refresh events
+	subscribers      map[chan RefreshEvent]struct{}
+	subscribersMutex sync.Mutex
+
+	// Owner is the account holder, either configured or derived from the assets' and comments' "IsMine" bool.
+	Owner identity.Identity
+	Mutex sync.RWMutex
 }
 
 func New() (*Server, error) {
@@ -45,18 +84,110 @@ func New() (*Server, error) {
 		Viper:   config.Read(),
 	}
 
+	var err error
+	r.Location, err = time.LoadLocation(r.Viper.GetString("timezone"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	r.metadata = metadata.NewCache(r.Location)
+
 	return r, nil
 }
 
+// MediaDir is where MediaStream keeps the album files, defaulting to the directory of the db
+func (s *Server) MediaDir() string {
+	if dir := s.Viper.GetString("mediaDir"); dir != "" {
+		return dir
+	}
+	return filepath.Dir(s.Viper.GetString("db"))
+}
+
+// BaseURL is the absolute URL clients reach the server at, from publicURL or the request itself
+func (s *Server) BaseURL(r *http.Request) string {
+	if u := s.Viper.GetString("publicURL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// XMPOptions returns how captions and comments are written into exported and mirrored files
+func (s *Server) XMPOptions() xmp.Options {
+	return xmp.Options{
+		Sidecar: s.Viper.GetBool("xmpSidecar"),
+		Embed:   s.Viper.GetBool("xmpEmbed"),
+	}
+}
+
+// OpenDatabase opens the configured iCloud database and checks its schema is one we can read
+func (s *Server) OpenDatabase() error {
+	database.File = s.Viper.GetString("db")
+	database.Immutable = s.Viper.GetBool("dbImmutable")
+	if database.Immutable && s.Viper.GetBool("dbSnapshotCopy") {
+		log.Warn().Msg("dbImmutable is set, so dbSnapshotCopy's copies miss changes that are only in the -wal file")
+	}
+	if err := database.Open(); err != nil {
+		return err
+	}
+
+	layout, known, err := database.Detect()
+	if err != nil {
+		return err
+	}
+	if !known {
+		log.Warn().Str("schema", layout.Name).Int("version", database.Version).Msg("Unknown database version, its tables match a known layout")
+	} else {
+		log.Info().Str("schema", layout.Name).Int("version", database.Version).Msg("Detected database schema")
+	}
+	return nil
+}
+
 func (s *Server) Start(binder func(s *Server, r *mux.Router)) {
 	s.router = mux.NewRouter().StrictSlash(true)
-	database.File = s.Viper.GetString("db")
 
-	err := database.Open()
+	err := s.OpenDatabase()
 	if err != nil {
 		log.Fatal().Err(err).Msg("Could not setup database")
 	}
 
+	if dir := s.Viper.GetString("mirrorDir"); dir != "" {
+		s.Mirror, err = mirror.New(dir, s.MediaDir(), s.Location, s.Viper.GetBool("mirrorDelete"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not open mirror")
+		}
+		s.Mirror.XMP = s.XMPOptions()
+	}
+
+	keys, err := s.configuredKeys()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not read API keys")
+	}
+	s.Keys, err = apikey.Open(s.Viper.GetString("keysFile"), keys)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not open API keys")
+	}
+	if err := s.ensureKey(); err != nil {
+		log.Fatal().Err(err).Msg("Could not generate an API key")
+	}
+
+	s.Shares, err = share.Open(s.Viper.GetString("shareFile"), s.Viper.GetString("shareSecret"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not open share links")
+	}
+
+	s.Journal, err = journal.Open(s.Viper.GetString("journalFile"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not open change journal")
+	}
+
+	s.Tombstones, err = tombstone.Open(s.Viper.GetString("tombstoneFile"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not open tombstones")
+	}
+
 	go s.infiniteReader(time.Duration(s.Viper.GetInt("recheckInterval")) * time.Millisecond)
 	binder(s, s.router)
 
@@ -95,7 +226,7 @@ func checkForNotificationsToSend(newAlbums []*album.Album) {
 			log.Info().Msg("New assets found, sending notifcations")
 			for author, count := range newAssetAuthors {
 				// Don't send notification about our own posted assets
-				if author == server.DeterminedName {
+				if server.Owner.Matches("", author) {
 					continue
 				}
 
@@ -114,16 +245,78 @@ func checkForNotificationsToSend(newAlbums []*album.Album) {
 }
 
 func (srv *Server) pollAlbums() {
-	newAlbums, err := album.GetAlbums(true)
+	srv.Mutex.RLock()
+	previous := srv.Albums
+	srv.Mutex.RUnlock()
+
+	// Read albums, assets and comments from one consistent state of the database
+	var newAlbums []*album.Album
+	read := func() error {
+		var err error
+		newAlbums, err = album.GetAlbums(true, previous, srv.Location)
+		return err
+	}
+	var err error
+	if srv.Viper.GetBool("dbSnapshotCopy") {
+		err = database.SnapshotCopy(srv.Viper.GetString("dbSnapshotDir"), read)
+	} else {
+		err = database.Snapshot(read)
+	}
 	if err != nil {
+		// Keep serving the albums from the last successful refresh
 		log.Error().Err(err).Msg("Failed to refresh albums")
+		return
 	}
 
+	srv.extractMetadata(newAlbums)
 	checkForNotificationsToSend(newAlbums)
+	owner := srv.determineOwner(newAlbums)
+	now := time.Now().UTC()
+	versions, setModified := srv.nextVersions(newAlbums, now)
 
 	srv.Mutex.Lock()
 	srv.Albums = newAlbums
+	srv.Owner = owner
+	srv.versions, srv.setModified = versions, setModified
 	srv.Mutex.Unlock()
+
+	changes, err := srv.Journal.Record(newAlbums)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update change journal")
+	}
+
+	if srv.Mirror != nil {
+		if err := srv.Mirror.Sync(newAlbums); err != nil {
+			log.Error().Err(err).Msg("Failed to update mirror")
+		}
+	}
+
+	// After the mirror sync, so assets it deleted aren't archived
+	srv.recordRemovals(changes, previous)
+
+	event := RefreshEvent{Date: now, AlbumCount: len(newAlbums)}
+	for _, a := range newAlbums {
+		event.AssetCount += len(a.Assets)
+	}
+	srv.publishRefresh(event)
+}
+
+// determineOwner prefers the configured owner, falling back to detection from the IsMine flags
+func (srv *Server) determineOwner(albums []*album.Album) identity.Identity {
+	configured := identity.Identity{
+		Name:     srv.Viper.GetString("ownerName"),
+		AuthorID: srv.Viper.GetString("ownerID"),
+		Source:   identity.SourceConfig,
+	}
+	if configured.Known() {
+		return configured
+	}
+
+	detected := identity.Detect(albums)
+	if !detected.Known() {
+		log.Warn().Msg("Could not determine the owner's identity, set ownerName or ownerID in the config")
+	}
+	return detected
 }
 
 func (srv *Server) infiniteReader(interval time.Duration) {
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestLocation returns the time zone named by the request's "tz" query parameter.
+// API dates are serialized in UTC unless a zone is requested.
+func RequestLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(tz)
+}
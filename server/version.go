@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/qcasey/airphoto-server/pkg/album"
+	"github.com/rs/zerolog/log"
+)
+
+// Version stamps the content of an album, or a set of albums, as of the latest refresh
+type Version struct {
+	// Tag changes whenever the content does
+	Tag string
+	// Modified is the refresh that last changed the content
+	Modified time.Time
+}
+
+// nextVersions stamps each album, keeping the previous stamp of albums that didn't change.
+// It also returns when the set of albums last changed, which is now if an album appeared or disappeared.
+func (s *Server) nextVersions(albums []*album.Album, now time.Time) (map[string]Version, time.Time) {
+	versions := make(map[string]Version, len(albums))
+	setModified := s.setModified
+	for _, a := range albums {
+		if _, ok := s.versions[a.GUID]; !ok {
+			setModified = now
+		}
+
+		encoded, err := json.Marshal(a)
+		if err != nil {
+			log.Error().Err(err).Str("album", a.GUID).Msg("Could not stamp album version")
+			continue
+		}
+		h := fnv.New64a()
+		h.Write(encoded)
+		tag := fmt.Sprintf("%016x", h.Sum64())
+
+		if previous, ok := s.versions[a.GUID]; ok && previous.Tag == tag {
+			versions[a.GUID] = previous
+			continue
+		}
+		versions[a.GUID] = Version{Tag: tag, Modified: now}
+	}
+	for guid := range s.versions {
+		if _, ok := versions[guid]; !ok {
+			setModified = now
+		}
+	}
+	return versions, setModified
+}
+
+// AlbumVersion returns the version of one album. The caller must hold s.Mutex.
+func (s *Server) AlbumVersion(guid string) Version {
+	return s.versions[guid]
+}
+
+// AlbumsVersion combines the versions of several albums. It's modified no earlier than the set of albums,
+// so removing an album moves it forward as well. The caller must hold s.Mutex.
+func (s *Server) AlbumsVersion(albums []*album.Album) Version {
+	versions := make([]string, 0, len(albums))
+	modified := s.setModified
+	for _, a := range albums {
+		v := s.versions[a.GUID]
+		versions = append(versions, a.GUID+v.Tag)
+		if v.Modified.After(modified) {
+			modified = v.Modified
+		}
+	}
+	sort.Strings(versions)
+
+	h := fnv.New64a()
+	for _, v := range versions {
+		h.Write([]byte(v))
+	}
+	return Version{Tag: fmt.Sprintf("%016x", h.Sum64()), Modified: modified}
+}
+
+// NotModified sets the ETag and Last-Modified headers for a response built from content at version v,
+// and answers with 304 Not Modified when the client's copy is current.
+// The ETag also covers the query string, since parameters such as "tz" change the body.
+func NotModified(w http.ResponseWriter, r *http.Request, v Version) bool {
+	query := r.URL.Query()
+	query.Del("token")
+	h := fnv.New64a()
+	h.Write([]byte(v.Tag))
+	h.Write([]byte(query.Encode()))
+	etag := fmt.Sprintf(`W/"%016x"`, h.Sum64())
+
+	w.Header().Set("ETag", etag)
+	if !v.Modified.IsZero() {
+		w.Header().Set("Last-Modified", v.Modified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err != nil || v.Modified.IsZero() || v.Modified.Truncate(time.Second).After(since) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches uses the weak comparison, ignoring "W/" prefixes
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range splitList(header) {
+		if candidate == "*" || trimWeak(candidate) == trimWeak(etag) {
+			return true
+		}
+	}
+	return false
+}
+
+func trimWeak(etag string) string {
+	if len(etag) > 2 && etag[:2] == "W/" {
+		return etag[2:]
+	}
+	return etag
+}